@@ -0,0 +1,372 @@
+package boot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sideboot/fdt"
+)
+
+const (
+	androidBootMagic   = "ANDROID!"
+	androidVendorMagic = "VNDRBOOT"
+	androidV3PageSize  = 4096
+	bootconfigTrailer  = "#BOOTCONFIG\n"
+)
+
+var androidFiles = []string{"*.img", "boot/*.img"}
+
+type AndroidBoot struct {
+	Version    uint32
+	Name       string
+	Cmdline    string
+	Kernel     []byte
+	Ramdisk    []byte
+	Second     []byte
+	Dtb        []byte
+	Bootconfig []byte
+}
+
+func ScanAndroid(root string) (*Config, error) {
+	cfg := &Config{}
+	for _, pattern := range androidFiles {
+		files, _ := filepath.Glob(filepath.Join(root, pattern))
+		for _, file := range files {
+			if !IsAndroidBoot(file) {
+				continue
+			}
+
+			name, _ := filepath.Rel(root, file)
+			cfg.Entries = append(cfg.Entries, Entry{Name: name, Title: "Android boot image " + name, Kernel: name})
+		}
+	}
+
+	return cfg, nil
+}
+
+func IsAndroidBoot(path string) bool {
+	return readMagic(path, len(androidBootMagic)) == androidBootMagic
+}
+
+func IsAndroidVendorBoot(path string) bool {
+	return readMagic(path, len(androidVendorMagic)) == androidVendorMagic
+}
+
+func readMagic(path string, size int) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	magic := make([]byte, size)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return ""
+	}
+
+	return string(magic)
+}
+
+type imageReader struct {
+	f    *os.File
+	off  int64
+	size int64
+	err  error
+}
+
+func newImageReader(f *os.File, off int64) *imageReader {
+	size, err := f.Seek(0, io.SeekEnd)
+	return &imageReader{f: f, off: off, size: size, err: err}
+}
+
+func (r *imageReader) section(size uint32, page uint32) []byte {
+	if r.err != nil || size == 0 {
+		return nil
+	}
+
+	if int64(size) > r.size-r.off {
+		r.err = fmt.Errorf("section at %d: %d bytes exceed the image size %d", r.off, size, r.size)
+		return nil
+	}
+
+	data := make([]byte, size)
+	if _, err := r.f.ReadAt(data, r.off); err != nil {
+		r.err = fmt.Errorf("section at %d: %w", r.off, err)
+		return nil
+	}
+
+	r.off += alignPage(int64(size), page)
+	return data
+}
+
+func alignPage(size int64, page uint32) int64 {
+	return (size + int64(page) - 1) / int64(page) * int64(page)
+}
+
+func cstring(data []byte) string {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+
+	return string(data)
+}
+
+func ReadAndroidBoot(path string) (*AndroidBoot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 1660)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("%s: header: %w", path, err)
+	}
+
+	if string(header[:8]) != androidBootMagic {
+		return nil, fmt.Errorf("%s: not an android boot image", path)
+	}
+
+	le := binary.LittleEndian
+	img := &AndroidBoot{Version: le.Uint32(header[40:])}
+
+	switch img.Version {
+	case 0, 1, 2:
+		page := le.Uint32(header[36:])
+		if page == 0 || page&(page-1) != 0 {
+			return nil, fmt.Errorf("%s: page size %d is invalid", path, page)
+		}
+
+		img.Name = cstring(header[48:64])
+		img.Cmdline = cstring(header[64:576]) + cstring(header[608:1632])
+
+		r := newImageReader(f, int64(page))
+		img.Kernel = r.section(le.Uint32(header[8:]), page)
+		img.Ramdisk = r.section(le.Uint32(header[16:]), page)
+		img.Second = r.section(le.Uint32(header[24:]), page)
+
+		if img.Version >= 1 {
+			r.section(le.Uint32(header[1632:]), page)
+		}
+
+		if img.Version == 2 {
+			img.Dtb = r.section(le.Uint32(header[1648:]), page)
+		}
+
+		if r.err != nil {
+			return nil, fmt.Errorf("%s: %w", path, r.err)
+		}
+	case 3, 4:
+		img.Cmdline = cstring(header[44:1580])
+
+		r := newImageReader(f, androidV3PageSize)
+		img.Kernel = r.section(le.Uint32(header[8:]), androidV3PageSize)
+		img.Ramdisk = r.section(le.Uint32(header[12:]), androidV3PageSize)
+
+		if r.err != nil {
+			return nil, fmt.Errorf("%s: %w", path, r.err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: boot image header version %d is not supported", path, img.Version)
+	}
+
+	if len(img.Kernel) == 0 {
+		return nil, fmt.Errorf("%s: boot image has no kernel", path)
+	}
+
+	img.Cmdline = strings.TrimSpace(img.Cmdline)
+	return img, nil
+}
+
+func (img *AndroidBoot) MergeVendor(path string) error {
+	if img.Version < 3 {
+		return fmt.Errorf("%s: vendor_boot needs a boot image version 3 or newer, got %d", path, img.Version)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, 2128)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		return fmt.Errorf("%s: header: %w", path, err)
+	}
+
+	if string(header[:8]) != androidVendorMagic {
+		return fmt.Errorf("%s: not a vendor_boot image", path)
+	}
+
+	le := binary.LittleEndian
+	version, page := le.Uint32(header[8:]), le.Uint32(header[12:])
+	if page == 0 || page&(page-1) != 0 {
+		return fmt.Errorf("%s: page size %d is invalid", path, page)
+	}
+
+	r := newImageReader(f, alignPage(int64(le.Uint32(header[2096:])), page))
+	ramdisk := r.section(le.Uint32(header[24:]), page)
+	img.Dtb = r.section(le.Uint32(header[2100:]), page)
+
+	if version >= 4 {
+		r.section(le.Uint32(header[2112:]), page)
+		img.Bootconfig = r.section(le.Uint32(header[2124:]), page)
+	}
+
+	if r.err != nil {
+		return fmt.Errorf("%s: %w", path, r.err)
+	}
+
+	img.Ramdisk = append(ramdisk, img.Ramdisk...)
+	img.Cmdline = strings.TrimSpace(cstring(header[28:2076]) + " " + img.Cmdline)
+	return nil
+}
+
+func (img *AndroidBoot) splitAppendedDtb() {
+	if len(img.Dtb) > 0 || len(img.Kernel) < 2 || img.Kernel[0] != 0x1f || img.Kernel[1] != 0x8b {
+		return
+	}
+
+	source := bytes.NewReader(img.Kernel)
+	reader, err := gzip.NewReader(source)
+	if err != nil {
+		return
+	}
+
+	reader.Multistream(false)
+	kernel, err := io.ReadAll(reader)
+	if err != nil {
+		return
+	}
+
+	rest := img.Kernel[len(img.Kernel)-source.Len():]
+	if blobs := fdt.SplitBlobs(rest); len(blobs) > 0 {
+		img.Kernel = kernel
+		img.Dtb = bytes.Join(blobs, nil)
+	}
+}
+
+func selectDtb(data []byte, machine []string) ([]byte, string) {
+	blobs := fdt.SplitBlobs(data)
+	if len(blobs) == 0 {
+		return nil, ""
+	}
+
+	best, score := 0, -1
+	for i, blob := range blobs {
+		tree, err := fdt.Parse(blob)
+		if err != nil {
+			continue
+		}
+
+		if s := fdt.Score(tree.Root.Strings("compatible"), machine); s >= 0 && (score < 0 || s < score) {
+			best, score = i, s
+		}
+	}
+
+	if score < 0 {
+		return blobs[0], "first device tree"
+	}
+
+	return blobs[best], "compatible " + machine[score]
+}
+
+func ExtractAndroidBoot(entry Entry, dir string, vendor string, machine []string) (Entry, error) {
+	img, err := ReadAndroidBoot(entry.Kernel)
+	if err != nil {
+		return entry, err
+	}
+
+	if vendor != "" {
+		if err := img.MergeVendor(vendor); err != nil {
+			return entry, err
+		}
+	}
+
+	img.splitAppendedDtb()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return entry, err
+	}
+
+	write := func(name string, data []byte) (string, error) {
+		file := filepath.Join(dir, name)
+		return file, os.WriteFile(file, data, 0o644)
+	}
+
+	source := entry.Kernel
+	if entry.Kernel, err = write("kernel", img.Kernel); err != nil {
+		return entry, err
+	}
+
+	if len(img.Second) > 0 {
+		if _, err := write("second", img.Second); err != nil {
+			return entry, err
+		}
+
+		log.Printf("android: %s: second stage bootloader is extracted but not used", source)
+	}
+
+	ramdisk := img.Ramdisk
+	if len(img.Bootconfig) > 0 {
+		ramdisk = appendBootconfig(ramdisk, img.Bootconfig)
+		img.Cmdline = strings.TrimSpace(img.Cmdline + " bootconfig")
+	}
+
+	if len(ramdisk) > 0 {
+		file, err := write("ramdisk", ramdisk)
+		if err != nil {
+			return entry, err
+		}
+
+		entry.Ramdisks = append([]string{file}, entry.Ramdisks...)
+	}
+
+	if entry.Dtb == "" && len(img.Dtb) > 0 {
+		dtb, reason := selectDtb(img.Dtb, machine)
+		if dtb == nil {
+			return entry, errors.New(source + ": device tree section holds no device tree")
+		}
+
+		log.Printf("android: %s: using %s", source, reason)
+		if entry.Dtb, err = write("dtb", dtb); err != nil {
+			return entry, err
+		}
+	}
+
+	entry.Cmdline = strings.TrimSpace(img.Cmdline + " " + entry.Cmdline)
+	if entry.Title == "" && img.Name != "" {
+		entry.Title = img.Name
+	}
+
+	return entry, nil
+}
+
+func appendBootconfig(ramdisk []byte, params []byte) []byte {
+	params = bytes.TrimRight(params, "\x00")
+	if !bytes.HasSuffix(params, []byte("\n")) {
+		params = append(params, '\n')
+	}
+
+	checksum := uint32(0)
+	for _, b := range params {
+		checksum += uint32(b)
+	}
+
+	trailer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(trailer, uint32(len(params)))
+	binary.LittleEndian.PutUint32(trailer[4:], checksum)
+
+	out := append([]byte{}, ramdisk...)
+	out = append(out, params...)
+	out = append(out, trailer...)
+	return append(out, bootconfigTrailer...)
+}
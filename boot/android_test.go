@@ -0,0 +1,225 @@
+package boot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeAndroidImage(t *testing.T, header []byte, page int, sections ...[]byte) string {
+	t.Helper()
+
+	pad := func(data []byte) []byte {
+		return append(append([]byte{}, data...), make([]byte, (page-len(data)%page)%page)...)
+	}
+
+	data := pad(header)
+	for _, section := range sections {
+		data = append(data, pad(section)...)
+	}
+
+	path := filepath.Join(t.TempDir(), "boot.img")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func testBootHeader(version uint32, sizes ...int) []byte {
+	le := binary.LittleEndian
+	header := make([]byte, 1660)
+	copy(header, androidBootMagic)
+	le.PutUint32(header[40:], version)
+
+	if version >= 3 {
+		le.PutUint32(header[8:], uint32(sizes[0]))
+		le.PutUint32(header[12:], uint32(sizes[1]))
+		copy(header[44:], "console=ttyMSM0")
+		return header
+	}
+
+	for i, off := range []int{8, 16, 24, 1632, 1648}[:len(sizes)] {
+		le.PutUint32(header[off:], uint32(sizes[i]))
+	}
+
+	le.PutUint32(header[36:], 2048)
+	copy(header[48:], "test")
+	copy(header[64:], "console=ttyMSM0")
+	copy(header[608:], " quiet")
+	return header
+}
+
+func testVendorHeader(version uint32, sizes ...int) []byte {
+	le := binary.LittleEndian
+	header := make([]byte, 2128)
+	copy(header, androidVendorMagic)
+	le.PutUint32(header[8:], version)
+	le.PutUint32(header[12:], 2048)
+	le.PutUint32(header[24:], uint32(sizes[0]))
+	copy(header[28:], "androidboot.hardware=qcom")
+	le.PutUint32(header[2096:], uint32(len(header)))
+	le.PutUint32(header[2100:], uint32(sizes[1]))
+
+	if version >= 4 {
+		le.PutUint32(header[2112:], uint32(sizes[2]))
+		le.PutUint32(header[2124:], uint32(sizes[3]))
+	}
+
+	return header
+}
+
+func TestReadAndroidBoot(t *testing.T) {
+	kernel, ramdisk, second, recovery, dtb := []byte("kernel"), []byte("ramdisk"), []byte("second"), []byte("recovery dtbo"), []byte("dtb")
+	tests := []struct {
+		version  uint32
+		page     int
+		sections [][]byte
+		want     AndroidBoot
+	}{
+		{0, 2048, [][]byte{kernel, ramdisk, second}, AndroidBoot{Name: "test", Cmdline: "console=ttyMSM0 quiet", Kernel: kernel, Ramdisk: ramdisk, Second: second}},
+		{1, 2048, [][]byte{kernel, ramdisk, second, recovery}, AndroidBoot{Name: "test", Cmdline: "console=ttyMSM0 quiet", Kernel: kernel, Ramdisk: ramdisk, Second: second}},
+		{2, 2048, [][]byte{kernel, ramdisk, second, recovery, dtb}, AndroidBoot{Name: "test", Cmdline: "console=ttyMSM0 quiet", Kernel: kernel, Ramdisk: ramdisk, Second: second, Dtb: dtb}},
+		{3, androidV3PageSize, [][]byte{kernel, ramdisk}, AndroidBoot{Cmdline: "console=ttyMSM0", Kernel: kernel, Ramdisk: ramdisk}},
+		{4, androidV3PageSize, [][]byte{kernel, ramdisk, []byte("signature")}, AndroidBoot{Cmdline: "console=ttyMSM0", Kernel: kernel, Ramdisk: ramdisk}},
+	}
+
+	for _, test := range tests {
+		sizes := []int{}
+		for _, section := range test.sections {
+			sizes = append(sizes, len(section))
+		}
+
+		img, err := ReadAndroidBoot(writeAndroidImage(t, testBootHeader(test.version, sizes...), test.page, test.sections...))
+		if err != nil {
+			t.Errorf("v%d: %s", test.version, err)
+			continue
+		}
+
+		test.want.Version = test.version
+		if img.Version != test.want.Version || img.Name != test.want.Name || img.Cmdline != test.want.Cmdline ||
+			!bytes.Equal(img.Kernel, test.want.Kernel) || !bytes.Equal(img.Ramdisk, test.want.Ramdisk) ||
+			!bytes.Equal(img.Second, test.want.Second) || !bytes.Equal(img.Dtb, test.want.Dtb) {
+			t.Errorf("v%d: got %+q, want %+q", test.version, img, test.want)
+		}
+	}
+}
+
+func TestReadAndroidBootErrors(t *testing.T) {
+	huge := func(version uint32, off int, size uint32) []byte {
+		header := testBootHeader(version, 6, 0)
+		binary.LittleEndian.PutUint32(header[off:], size)
+		return header
+	}
+
+	tests := map[string][]byte{
+		"version":   testBootHeader(5, 6, 0),
+		"no kernel": testBootHeader(3, 0, 7),
+		"page size": func() []byte {
+			header := testBootHeader(0, 6)
+			binary.LittleEndian.PutUint32(header[36:], 3000)
+			return header
+		}(),
+		"not android":  make([]byte, 1660),
+		"truncated":    testBootHeader(0, 6, 8192),
+		"huge kernel":  huge(3, 8, 0xffffffff),
+		"huge ramdisk": huge(2, 16, 0xfffff000),
+	}
+
+	for name, header := range tests {
+		if _, err := ReadAndroidBoot(writeAndroidImage(t, header, 4096, []byte("kernel"))); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestMergeVendor(t *testing.T) {
+	img := &AndroidBoot{Version: 4, Cmdline: "console=ttyMSM0", Kernel: []byte("kernel"), Ramdisk: []byte("generic")}
+	vendor := writeAndroidImage(t, testVendorHeader(4, 6, 3, 108, 15), 2048,
+		[]byte("vendor"), []byte("dtb"), make([]byte, 108), []byte("androidboot.a=1"))
+
+	if err := img.MergeVendor(vendor); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(img.Ramdisk) != "vendorgeneric" {
+		t.Errorf("ramdisk = %q, want the vendor ramdisk first", img.Ramdisk)
+	}
+
+	if img.Cmdline != "androidboot.hardware=qcom console=ttyMSM0" {
+		t.Errorf("cmdline = %q", img.Cmdline)
+	}
+
+	if string(img.Dtb) != "dtb" || string(img.Bootconfig) != "androidboot.a=1" {
+		t.Errorf("dtb = %q, bootconfig = %q", img.Dtb, img.Bootconfig)
+	}
+
+	v3 := &AndroidBoot{Version: 3}
+	if err := v3.MergeVendor(writeAndroidImage(t, testVendorHeader(3, 6, 3), 2048, []byte("vendor"), []byte("dtb"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(v3.Ramdisk) != "vendor" || string(v3.Dtb) != "dtb" || v3.Bootconfig != nil {
+		t.Errorf("v3: ramdisk = %q, dtb = %q, bootconfig = %q", v3.Ramdisk, v3.Dtb, v3.Bootconfig)
+	}
+
+	if err := (&AndroidBoot{Version: 2}).MergeVendor(vendor); err == nil {
+		t.Error("v2 boot image: expected an error")
+	}
+
+	header := testVendorHeader(3, 6, 3)
+	binary.LittleEndian.PutUint32(header[2096:], 0xfffffc00)
+	if err := v3.MergeVendor(writeAndroidImage(t, header, 2048, []byte("vendor"), []byte("dtb"))); err == nil {
+		t.Error("huge header size: expected an error")
+	}
+}
+
+func TestAppendBootconfig(t *testing.T) {
+	got := appendBootconfig([]byte("ramdisk"), []byte("a=1\x00\x00"))
+	want := "ramdisk" + "a=1\n" + "\x04\x00\x00\x00" + "\xd9\x00\x00\x00" + bootconfigTrailer
+	if string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got := appendBootconfig(nil, []byte("b=2\n")); !bytes.HasPrefix(got, []byte("b=2\n\x04\x00")) {
+		t.Errorf("newline terminated: got %q", got)
+	}
+}
+
+func TestSplitAppendedDtb(t *testing.T) {
+	var dtbs []byte
+	for _, name := range []string{"sc7180-trogdor-lazor-r3.dtb", "sc7180-trogdor-kingoftown.dtb"} {
+		data, err := os.ReadFile(filepath.Join("../kernel/dtbs/qcom", name))
+		if err != nil {
+			t.Skip(err)
+		}
+
+		dtbs = append(dtbs, data...)
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte("arm kernel"))
+	w.Close()
+
+	img := &AndroidBoot{Kernel: append(buf.Bytes(), dtbs...)}
+	img.splitAppendedDtb()
+	if string(img.Kernel) != "arm kernel" || !bytes.Equal(img.Dtb, dtbs) {
+		t.Errorf("kernel = %q, dtb is %d bytes, want %d", img.Kernel, len(img.Dtb), len(dtbs))
+	}
+
+	for _, img := range []*AndroidBoot{
+		{Kernel: buf.Bytes()},
+		{Kernel: append(buf.Bytes(), dtbs...), Dtb: []byte("dtb")},
+		{Kernel: []byte("plain kernel")},
+	} {
+		kernel := img.Kernel
+		img.splitAppendedDtb()
+		if !bytes.Equal(img.Kernel, kernel) {
+			t.Errorf("%q: kernel changed", kernel[:2])
+		}
+	}
+}
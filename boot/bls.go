@@ -0,0 +1,311 @@
+package boot
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type blsEntry struct {
+	Entry
+	id        string
+	version   string
+	sortKey   string
+	machineID string
+}
+
+var blsArchitectures = map[string]string{
+	"amd64": "x64",
+	"386":   "ia32",
+	"arm64": "aa64",
+	"arm":   "arm",
+}
+
+func ScanBLS(root string) (*Config, error) {
+	files, err := filepath.Glob(filepath.Join(root, "loader/entries/*.conf"))
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	if len(files) == 0 {
+		return cfg, nil
+	}
+
+	kernelopts := readGrubEnv(root)["kernelopts"]
+
+	entries := []blsEntry{}
+	for _, file := range files {
+		entry, err := parseBLSFile(file, kernelopts)
+		if err != nil {
+			log.Print("bls: ", err)
+			continue
+		}
+
+		if entry.Kernel != "" {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return blsLess(entries[i], entries[j])
+	})
+
+	for _, entry := range entries {
+		cfg.Entries = append(cfg.Entries, entry.Entry)
+	}
+
+	loader, err := readKeyValues(filepath.Join(root, "loader/loader.conf"))
+	if err == nil {
+		if pattern := loader["default"]; pattern != "" {
+			for _, entry := range entries {
+				if ok, _ := path.Match(pattern, entry.id+".conf"); ok || pattern == entry.id {
+					cfg.Default = entry.Name
+					break
+				}
+			}
+		}
+
+		if timeout, err := strconv.Atoi(loader["timeout"]); err == nil {
+			cfg.Timeout = timeout
+		}
+	}
+
+	return cfg, nil
+}
+
+func parseBLSFile(file string, kernelopts string) (blsEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return blsEntry{}, err
+	}
+	defer f.Close()
+
+	entry := blsEntry{id: strings.TrimSuffix(filepath.Base(file), ".conf")}
+	entry.Name = entry.id
+
+	options := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value := cutSpace(line)
+
+		switch key {
+		case "title":
+			entry.Title = value
+		case "version":
+			entry.version = value
+		case "sort-key":
+			entry.sortKey = value
+		case "machine-id":
+			entry.machineID = value
+		case "linux":
+			entry.Kernel = bootPath(value)
+		case "initrd":
+			for _, initrd := range strings.Fields(value) {
+				entry.Ramdisks = append(entry.Ramdisks, bootPath(initrd))
+			}
+		case "options":
+			options = append(options, strings.ReplaceAll(value, "$kernelopts", kernelopts))
+		case "devicetree":
+			entry.Dtb = bootPath(value)
+		case "devicetree-overlay":
+			for _, overlay := range strings.Fields(value) {
+				entry.Overlays = append(entry.Overlays, bootPath(overlay))
+			}
+		case "architecture":
+			if arch := blsArchitectures[runtime.GOARCH]; !strings.EqualFold(value, arch) {
+				return entry, fmt.Errorf("%s: architecture %s doesn't match %s", file, value, arch)
+			}
+		case "efi":
+			entry.Kernel = bootPath(value)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return entry, fmt.Errorf("%s: %w", file, err)
+	}
+
+	entry.Cmdline = strings.Join(options, " ")
+	if entry.Title == "" {
+		entry.Title = entry.id
+	}
+
+	if entry.version != "" && !strings.Contains(entry.Title, entry.version) {
+		entry.Title = fmt.Sprintf("%s (%s)", entry.Title, entry.version)
+	}
+
+	return entry, nil
+}
+
+func blsLess(a, b blsEntry) bool {
+	if (a.sortKey == "") != (b.sortKey == "") {
+		return a.sortKey != ""
+	}
+
+	if a.sortKey == "" {
+		return CompareVersions(a.id, b.id) > 0
+	}
+
+	if a.sortKey != b.sortKey {
+		return a.sortKey < b.sortKey
+	}
+
+	if a.machineID != b.machineID {
+		return a.machineID < b.machineID
+	}
+
+	if c := CompareVersions(a.version, b.version); c != 0 {
+		return c > 0
+	}
+
+	return CompareVersions(a.id, b.id) > 0
+}
+
+func CompareVersions(a, b string) int {
+	for {
+		a = strings.TrimLeftFunc(a, isVersionSeparator)
+		b = strings.TrimLeftFunc(b, isVersionSeparator)
+
+		ra, rb := versionRank(a), versionRank(b)
+		if ra != rb {
+			return compareInts(ra, rb)
+		}
+
+		switch ra {
+		case 1:
+			return 0
+		case 5:
+			wa, wb := versionWord(a, isVersionLetter), versionWord(b, isVersionLetter)
+			if c := strings.Compare(wa, wb); c != 0 {
+				return c
+			}
+
+			a, b = a[len(wa):], b[len(wb):]
+		case 6:
+			wa, wb := versionWord(a, isVersionDigit), versionWord(b, isVersionDigit)
+			na, nb := strings.TrimLeft(wa, "0"), strings.TrimLeft(wb, "0")
+			if len(na) != len(nb) {
+				return compareInts(len(na), len(nb))
+			}
+
+			if c := strings.Compare(na, nb); c != 0 {
+				return c
+			}
+
+			a, b = a[len(wa):], b[len(wb):]
+		default:
+			a, b = a[1:], b[1:]
+		}
+	}
+}
+
+func versionRank(s string) int {
+	if s == "" {
+		return 1
+	}
+
+	switch c := rune(s[0]); {
+	case c == '~':
+		return 0
+	case c == '-':
+		return 2
+	case c == '^':
+		return 3
+	case c == '.':
+		return 4
+	case isVersionLetter(c):
+		return 5
+	default:
+		return 6
+	}
+}
+
+func versionWord(s string, class func(rune) bool) string {
+	if i := strings.IndexFunc(s, func(c rune) bool { return !class(c) }); i >= 0 {
+		return s[:i]
+	}
+
+	return s
+}
+
+func isVersionLetter(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isVersionDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isVersionSeparator(c rune) bool {
+	return !isVersionLetter(c) && !isVersionDigit(c) && !strings.ContainsRune("~-^.", c)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+func bootPath(value string) string {
+	return strings.TrimPrefix(path.Clean("/"+value), "/")
+}
+
+func readGrubEnv(root string) map[string]string {
+	for _, name := range []string{"grub2/grubenv", "grub/grubenv"} {
+		if env, err := readKeyValues(filepath.Join(root, name)); err == nil {
+			return env
+		}
+	}
+
+	return map[string]string{}
+}
+
+func readKeyValues(file string) (map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			key, value = cutSpace(line)
+		}
+
+		values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	return values, nil
+}
+
+func cutSpace(line string) (string, string) {
+	i := strings.IndexAny(line, " \t")
+	if i < 0 {
+		return line, ""
+	}
+
+	return line[:i], strings.TrimSpace(line[i+1:])
+}
@@ -0,0 +1,186 @@
+package boot
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for name, data := range files {
+		file := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"1", "1", 0},
+		{"1", "2", -1},
+		{"2", "10", -1},
+		{"010", "10", 0},
+		{"6.6.1", "6.6.1", 0},
+		{"6.6.1", "6.6.10", -1},
+		{"6.10", "6.9.12", 1},
+		{"6.6", "6.6.1", -1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0", "1.0-1", -1},
+		{"1.0^git1", "1.0", 1},
+		{"1.0^git1", "1.0.1", -1},
+		{"1.0-1", "1.0^git1", -1},
+		{"1.0a", "1.0", 1},
+		{"1.0a", "1.0.1", 1},
+		{"a", "b", -1},
+		{"B", "a", -1},
+		{"1_2", "1.2", 1},
+		{"1_2", "1+2", 0},
+		{"6.8.9-arch1-1", "6.8.10-arch1-1", -1},
+		{"6.8.0-rc7", "6.8.0", 1},
+		{"fc39", "fc40", -1},
+		{"é", "", 0},
+	}
+
+	for _, test := range tests {
+		if got := CompareVersions(test.a, test.b); got != test.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+
+		if got := CompareVersions(test.b, test.a); got != -test.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", test.b, test.a, got, -test.want)
+		}
+	}
+}
+
+func testBLSRoot(t *testing.T, loader string) string {
+	t.Helper()
+
+	return writeTestFiles(t, map[string]string{
+		"loader/loader.conf": loader,
+		"grub2/grubenv":      "# GRUB Environment Block\nkernelopts=root=UUID=1234 rw\n",
+		"loader/entries/fedora-6.6.1.conf": `# installed by kernel-install
+title      Fedora
+version    6.6.1
+sort-key   fedora
+machine-id 0123
+linux      /vmlinuz-6.6.1
+initrd     /intel-ucode.img
+initrd     /initramfs-6.6.1.img
+options    $kernelopts
+options    quiet
+devicetree /dtbs/6.6.1/qcom/sc7180-idp.dtb
+`,
+		"loader/entries/fedora-6.10.0.conf": "title Fedora\nversion 6.10.0\nsort-key fedora\nmachine-id 0123\nlinux /vmlinuz-6.10.0\n",
+		"loader/entries/debian.conf":        "title Debian 12\nversion 12\nsort-key debian\nlinux vmlinuz\n",
+		"loader/entries/arch.conf":          "title Arch Linux\nlinux /vmlinuz-linux\ninitrd /initramfs-linux.img /amd-ucode.img\n",
+		"loader/entries/alpine.conf":        "linux /vmlinuz-lts\n",
+		"loader/entries/no-kernel.conf":     "title Missing\n",
+		"loader/entries/other-arch.conf":    "title Other\nlinux /vmlinuz\narchitecture sparc\n",
+		"loader/entries/readme.txt":         "linux /vmlinuz\n",
+	})
+}
+
+func TestScanBLS(t *testing.T) {
+	cfg, err := ScanBLS(testBLSRoot(t, "timeout 3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, entry := range cfg.Entries {
+		names = append(names, entry.Name)
+	}
+
+	if want := []string{"debian", "fedora-6.10.0", "fedora-6.6.1", "arch", "alpine"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("order = %q, want %q", names, want)
+	}
+
+	if cfg.Timeout != 3 || cfg.Default != "" {
+		t.Errorf("timeout = %d, default = %q", cfg.Timeout, cfg.Default)
+	}
+
+	want := []Entry{
+		{Name: "debian", Title: "Debian 12", Kernel: "vmlinuz"},
+		{Name: "fedora-6.10.0", Title: "Fedora (6.10.0)", Kernel: "vmlinuz-6.10.0"},
+		{
+			Name:     "fedora-6.6.1",
+			Title:    "Fedora (6.6.1)",
+			Kernel:   "vmlinuz-6.6.1",
+			Ramdisks: []string{"intel-ucode.img", "initramfs-6.6.1.img"},
+			Cmdline:  "root=UUID=1234 rw quiet",
+			Dtb:      "dtbs/6.6.1/qcom/sc7180-idp.dtb",
+		},
+		{Name: "arch", Title: "Arch Linux", Kernel: "vmlinuz-linux", Ramdisks: []string{"initramfs-linux.img", "amd-ucode.img"}},
+		{Name: "alpine", Title: "alpine", Kernel: "vmlinuz-lts"},
+	}
+
+	if !reflect.DeepEqual(cfg.Entries, want) {
+		t.Errorf("got %+v\nwant %+v", cfg.Entries, want)
+	}
+
+	if cfg, err := ScanBLS(t.TempDir()); err != nil || len(cfg.Entries) != 0 {
+		t.Errorf("no entries: got %+v, %v", cfg, err)
+	}
+}
+
+func TestScanBLSDefault(t *testing.T) {
+	tests := []struct {
+		loader string
+		want   string
+	}{
+		{"default fedora-6.6.1.conf", "fedora-6.6.1"},
+		{"default fedora-*", "fedora-6.10.0"},
+		{"default fedora-6.6*", "fedora-6.6.1"},
+		{"default arch", "arch"},
+		{"default\tdeb?an.conf\ntimeout 0", "debian"},
+		{"default ubuntu-*", ""},
+		{"timeout 5", ""},
+	}
+
+	for _, test := range tests {
+		cfg, err := ScanBLS(testBLSRoot(t, test.loader))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cfg.Default != test.want {
+			t.Errorf("%q: default = %q, want %q", test.loader, cfg.Default, test.want)
+		}
+	}
+}
+
+func TestBLSLess(t *testing.T) {
+	entries := []blsEntry{
+		{id: "e", sortKey: "arch"},
+		{id: "c", sortKey: "fedora", machineID: "0", version: "5.0"},
+		{id: "d", sortKey: "fedora", machineID: "1", version: "6.10"},
+		{id: "b", sortKey: "fedora", machineID: "1", version: "6.6"},
+		{id: "a", sortKey: "fedora", machineID: "1", version: "6.6"},
+		{id: "linux-6.10"},
+		{id: "linux-6.9"},
+	}
+
+	for i := range entries {
+		for j := range entries {
+			if got, want := blsLess(entries[i], entries[j]), i < j; got != want {
+				t.Errorf("blsLess(%s, %s) = %v, want %v", entries[i].id, entries[j].id, got, want)
+			}
+		}
+	}
+}
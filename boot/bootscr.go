@@ -0,0 +1,422 @@
+package boot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	uImageMagic      = 0x27051956
+	uImageHeaderSize = 64
+	uImageTypeScript = 6
+)
+
+var bootScrFiles = []string{
+	"boot.scr.uimg",
+	"boot.scr",
+	"boot/boot.scr.uimg",
+	"boot/boot.scr",
+}
+
+var bootScrIgnored = map[string]bool{
+	"echo": true, "sleep": true, "itest": true, "true": true, "false": true,
+	"printenv": true, "saveenv": true, "gpio": true, "led": true, "mmc": true,
+	"usb": true, "scsi": true, "nvme": true,
+}
+
+var bootScrAddrs = []string{
+	"kernel_addr_r", "ramdisk_addr_r", "fdt_addr_r", "fdtoverlay_addr_r",
+	"scriptaddr", "pxefile_addr_r", "kernel_comp_addr_r", "loadaddr",
+}
+
+func ScanBootScr(root string) (*Config, error) {
+	for _, name := range bootScrFiles {
+		entry, err := ParseBootScrFile(root, name)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Config{Entries: []Entry{entry}}, nil
+	}
+
+	return &Config{}, nil
+}
+
+func ParseBootScrFile(root string, name string) (Entry, error) {
+	data, err := os.ReadFile(filepath.Join(root, name))
+	if err != nil {
+		return Entry{}, err
+	}
+
+	title := name
+	if len(data) >= 4 && binary.BigEndian.Uint32(data) == uImageMagic {
+		var image string
+		image, data, err = UnwrapScript(data)
+		if err != nil {
+			return Entry{}, fmt.Errorf("%s: %w", name, err)
+		}
+
+		if image != "" {
+			title = image
+		}
+	}
+
+	cmds, err := parseScript(string(data))
+	if err != nil {
+		return Entry{}, fmt.Errorf("%s: %w", name, err)
+	}
+
+	interp := &bootScrInterp{
+		root:  root,
+		file:  name,
+		addrs: map[string]string{},
+		dirs:  map[string]string{},
+		vars: map[string]string{
+			"prefix":          path.Dir("/"+name) + "/",
+			"devtype":         "mmc",
+			"devnum":          "0",
+			"distro_bootpart": "1",
+			"fdtfile":         "",
+		},
+		entry: Entry{Name: name, Title: title},
+	}
+
+	for _, addr := range bootScrAddrs {
+		interp.vars[addr] = addr
+	}
+
+	interp.run(cmds)
+	if !interp.booted {
+		return Entry{}, fmt.Errorf("%s: script never reaches booti or bootz", name)
+	}
+
+	return interp.entry, nil
+}
+
+func UnwrapScript(data []byte) (string, []byte, error) {
+	if len(data) < uImageHeaderSize {
+		return "", nil, errors.New("legacy image header is truncated")
+	}
+
+	header := make([]byte, uImageHeaderSize)
+	copy(header, data)
+	hcrc := binary.BigEndian.Uint32(header[4:])
+	binary.BigEndian.PutUint32(header[4:], 0)
+	if crc32.ChecksumIEEE(header) != hcrc {
+		return "", nil, errors.New("legacy image header checksum mismatch")
+	}
+
+	if header[30] != uImageTypeScript {
+		return "", nil, fmt.Errorf("legacy image type %d is not a script", header[30])
+	}
+
+	size := binary.BigEndian.Uint32(header[12:])
+	body := data[uImageHeaderSize:]
+	if uint32(len(body)) < size {
+		return "", nil, errors.New("legacy image data is truncated")
+	}
+
+	body = body[:size]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(header[24:]) {
+		return "", nil, errors.New("legacy image data checksum mismatch")
+	}
+
+	sizes := []uint32{}
+	for len(body) >= 4 {
+		length := binary.BigEndian.Uint32(body)
+		body = body[4:]
+		if length == 0 {
+			break
+		}
+
+		sizes = append(sizes, length)
+	}
+
+	if len(sizes) == 0 || uint32(len(body)) < sizes[0] {
+		return "", nil, errors.New("legacy image script is truncated")
+	}
+
+	name := string(bytes.TrimRight(header[32:], "\x00"))
+	return name, bytes.TrimRight(body[:sizes[0]], "\x00"), nil
+}
+
+type bootScrInterp struct {
+	root   string
+	file   string
+	vars   map[string]string
+	addrs  map[string]string
+	dirs   map[string]string
+	entry  Entry
+	booted bool
+	depth  int
+}
+
+func (b *bootScrInterp) warn(line int, format string, args ...any) {
+	log.Printf("bootscr: %s:%d: %s", b.file, line, fmt.Sprintf(format, args...))
+}
+
+func (b *bootScrInterp) run(cmds []scriptCmd) bool {
+	ok := true
+	for _, cmd := range cmds {
+		if b.booted {
+			break
+		}
+
+		ok = b.exec(cmd)
+	}
+
+	return ok
+}
+
+func (b *bootScrInterp) exec(cmd scriptCmd) bool {
+	if len(cmd.words) == 0 {
+		return true
+	}
+
+	switch cmd.words[0] {
+	case "if":
+		for _, branch := range cmd.branches {
+			if branch.cond == nil || b.chain(branch.cond, cmd.line) {
+				return b.run(branch.body)
+			}
+		}
+
+		return true
+	case "for", "while", "until":
+		b.warn(cmd.line, "%s loops are not supported, skipping", cmd.words[0])
+		return false
+	}
+
+	if cmd.body != nil {
+		b.warn(cmd.line, "function %s is not supported, skipping", cmd.words[0])
+		return false
+	}
+
+	return b.chain(cmd.words, cmd.line)
+}
+
+func (b *bootScrInterp) chain(words []string, line int) bool {
+	ok, op, start := true, "", 0
+	for i := 0; i <= len(words); i++ {
+		if i < len(words) && words[i] != "&&" && words[i] != "||" {
+			continue
+		}
+
+		if op == "" || (op == "&&" && ok) || (op == "||" && !ok) {
+			ok = b.command(words[start:i], line)
+		}
+
+		if i < len(words) {
+			op, start = words[i], i+1
+		}
+	}
+
+	return ok
+}
+
+func (b *bootScrInterp) command(words []string, line int) bool {
+	if len(words) == 0 {
+		return true
+	}
+
+	args := []string{}
+	for _, word := range words {
+		args = append(args, expandVars(word, b.vars))
+	}
+
+	name := args[0]
+	args = args[1:]
+
+	switch name {
+	case "setenv", "env":
+		if name == "env" {
+			if len(args) == 0 || args[0] != "set" {
+				b.warn(line, "env %s is not supported", strings.Join(args, " "))
+				return false
+			}
+
+			args = args[1:]
+		}
+
+		if len(args) > 0 && args[0] == "-f" {
+			args = args[1:]
+		}
+
+		if len(args) == 0 {
+			return false
+		}
+
+		if len(args) == 1 {
+			delete(b.vars, args[0])
+		} else {
+			b.vars[args[0]] = strings.Join(args[1:], " ")
+		}
+	case "load", "ext2load", "ext4load", "fatload", "btrfsload", "sqfsload":
+		return b.load(args, line)
+	case "unzip":
+		if len(args) < 2 || b.addrs[args[0]] == "" {
+			b.warn(line, "unzip from an address nothing was loaded to")
+			return false
+		}
+
+		b.addrs[args[1]] = b.addrs[args[0]]
+	case "booti", "bootz":
+		return b.boot(name, args, line)
+	case "test":
+		return b.test(args, line)
+	case "run":
+		for _, script := range args {
+			if !b.runVar(script, line) {
+				return false
+			}
+		}
+	case "fdt":
+		if len(args) > 0 && (args[0] == "addr" || args[0] == "resize") {
+			return true
+		}
+
+		b.warn(line, "fdt %s is not supported", strings.Join(args, " "))
+		return false
+	default:
+		if !bootScrIgnored[name] {
+			b.warn(line, "unsupported command %s", name)
+			return false
+		}
+	}
+
+	return true
+}
+
+func (b *bootScrInterp) load(args []string, line int) bool {
+	if len(args) < 4 {
+		b.warn(line, "load needs interface, device, address and file")
+		return false
+	}
+
+	if dev, part, ok := strings.Cut(args[1], ":"); ok && (dev != b.vars["devnum"] || part != b.vars["distro_bootpart"]) {
+		b.warn(line, "load from %s %s assumes the script's own partition", args[0], args[1])
+	}
+
+	file := bootPath(args[3])
+	info, err := os.Stat(filepath.Join(b.root, file))
+	if err != nil {
+		b.warn(line, "load of %s failed, it is not on the boot partition", file)
+		return false
+	}
+
+	if info.IsDir() {
+		b.warn(line, "load of directory %s, fdtfile is probably unset", file)
+		b.dirs[args[2]] = file
+		return false
+	}
+
+	b.addrs[args[2]] = file
+	b.vars["filesize"] = strconv.FormatInt(info.Size(), 16)
+	return true
+}
+
+func (b *bootScrInterp) boot(name string, args []string, line int) bool {
+	addr := func(i int) string {
+		if i >= len(args) || args[i] == "-" {
+			return ""
+		}
+
+		value, _, _ := strings.Cut(args[i], ":")
+		return value
+	}
+
+	kernel := b.addrs[addr(0)]
+	if addr(0) == "" {
+		kernel = b.addrs[b.vars["loadaddr"]]
+	}
+
+	if kernel == "" {
+		b.warn(line, "%s without a loaded kernel", name)
+		return false
+	}
+
+	b.entry.Kernel = kernel
+	b.entry.Cmdline = b.vars["bootargs"]
+
+	if ramdisk := addr(1); ramdisk != "" {
+		if b.addrs[ramdisk] == "" {
+			b.warn(line, "%s ramdisk address %s has nothing loaded", name, ramdisk)
+			return false
+		}
+
+		b.entry.Ramdisks = append(b.entry.Ramdisks, b.addrs[ramdisk])
+	}
+
+	if fdt := addr(2); fdt != "" {
+		switch {
+		case b.addrs[fdt] != "":
+			b.entry.Dtb = b.addrs[fdt]
+		case b.dirs[fdt] != "":
+			b.entry.DtbDir = b.dirs[fdt]
+			b.warn(line, "%s device tree address %s has nothing loaded, selecting a device tree from %s", name, fdt, b.dirs[fdt])
+		default:
+			b.warn(line, "%s device tree address %s has nothing loaded, keeping the running device tree", name, fdt)
+		}
+	}
+
+	b.booted = true
+	return true
+}
+
+func (b *bootScrInterp) test(args []string, line int) bool {
+	negate := len(args) > 0 && args[0] == "!"
+	if negate {
+		args = args[1:]
+	}
+
+	result := false
+	switch {
+	case len(args) == 3 && (args[1] == "=" || args[1] == "=="):
+		result = args[0] == args[2]
+	case len(args) == 3 && args[1] == "!=":
+		result = args[0] != args[2]
+	case len(args) == 2 && args[0] == "-n":
+		result = args[1] != ""
+	case len(args) == 2 && args[0] == "-z":
+		result = args[1] == ""
+	case len(args) == 4 && args[0] == "-e":
+		_, err := os.Stat(filepath.Join(b.root, bootPath(args[3])))
+		result = err == nil
+	default:
+		b.warn(line, "test %s is not supported, assuming false", strings.Join(args, " "))
+		return false
+	}
+
+	return result != negate
+}
+
+func (b *bootScrInterp) runVar(name string, line int) bool {
+	if b.depth > 8 {
+		b.warn(line, "run %s nests too deep", name)
+		return false
+	}
+
+	cmds, err := parseScript(b.vars[name])
+	if err != nil {
+		b.warn(line, "run %s: %s", name, err)
+		return false
+	}
+
+	b.depth++
+	defer func() { b.depth-- }()
+
+	return b.run(cmds)
+}
@@ -0,0 +1,60 @@
+package boot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBootScrDtb(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  string
+		dtb    string
+		dtbDir string
+	}{
+		{"fdtfile set", "setenv fdtfile rockchip/board.dtb", "dtbs/rockchip/board.dtb", ""},
+		{"fdtfile unset", "", "", "dtbs"},
+		{"fdtfile missing", "setenv fdtfile rockchip/other.dtb", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			script := test.setup + `
+setenv bootargs console=ttyS2
+load ${devtype} ${devnum}:${distro_bootpart} ${kernel_addr_r} ${prefix}Image
+load ${devtype} ${devnum}:${distro_bootpart} ${fdt_addr_r} ${prefix}dtbs/${fdtfile}
+booti ${kernel_addr_r} - ${fdt_addr_r}
+`
+			files := map[string]string{
+				"boot.cmd":                script,
+				"Image":                   "kernel",
+				"dtbs/rockchip/board.dtb": "dtb",
+			}
+
+			for name, data := range files {
+				if err := os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0o755); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := os.WriteFile(filepath.Join(root, name), []byte(data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			entry, err := ParseBootScrFile(root, "boot.cmd")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if entry.Kernel != "Image" || entry.Cmdline != "console=ttyS2" {
+				t.Errorf("unexpected entry %+v", entry)
+			}
+
+			if entry.Dtb != test.dtb || entry.DtbDir != test.dtbDir {
+				t.Errorf("dtb = %q, dtbdir = %q, want %q, %q", entry.Dtb, entry.DtbDir, test.dtb, test.dtbDir)
+			}
+		})
+	}
+}
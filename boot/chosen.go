@@ -0,0 +1,87 @@
+package boot
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"sideboot/fdt"
+)
+
+const rngSeedSize = 64
+
+type Chosen struct {
+	Bootargs    string
+	InitrdStart uint64
+	InitrdEnd   uint64
+	Seeds       bool
+	Properties  map[string]string
+}
+
+func (c Chosen) Apply(tree *fdt.Tree) error {
+	chosen := tree.Create("/chosen")
+
+	if c.Bootargs != "" {
+		chosen.SetString("bootargs", c.Bootargs)
+	}
+
+	if c.InitrdEnd > c.InitrdStart {
+		chosen.SetUint64("linux,initrd-start", c.InitrdStart)
+		chosen.SetUint64("linux,initrd-end", c.InitrdEnd)
+	}
+
+	if c.Seeds {
+		seed := make([]byte, rngSeedSize+8)
+		if _, err := rand.Read(seed); err != nil {
+			return err
+		}
+
+		chosen.SetProperty("rng-seed", seed[:rngSeedSize])
+		chosen.SetUint64("kaslr-seed", binary.BigEndian.Uint64(seed[rngSeedSize:]))
+	}
+
+	for name, value := range c.Properties {
+		chosen.SetString("sideboot,"+name, value)
+	}
+
+	return nil
+}
+
+func ApplyOverlays(tree *fdt.Tree, overlays []string) error {
+	for _, path := range overlays {
+		overlay, err := fdt.Load(path)
+		if err != nil {
+			return fmt.Errorf("overlay %w", err)
+		}
+
+		if err := tree.ApplyOverlay(overlay); err != nil {
+			return fmt.Errorf("overlay %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+func PatchDtb(path string, overlays []string, dir string, chosen Chosen) (string, error) {
+	tree, err := fdt.Load(path)
+	if err != nil {
+		return "", err
+	}
+
+	if err := ApplyOverlays(tree, overlays); err != nil {
+		return "", err
+	}
+
+	if err := chosen.Apply(tree); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	out := filepath.Join(dir, "patched.dtb")
+	return out, tree.WriteFile(out)
+}
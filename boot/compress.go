@@ -0,0 +1,334 @@
+package boot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+const (
+	lz4LegacyMagic = 0x184c2102
+	lz4FrameMagic  = 0x184d2204
+	lz4LegacyBlock = 8 << 20
+
+	xzStreamHeader = 12
+	xzFilterLzma2  = 0x21
+)
+
+var errLz4Corrupt = errors.New("lz4: corrupt input")
+
+var xzFilterNames = map[uint64]string{
+	0x03: "delta",
+	0x04: "x86 BCJ",
+	0x05: "PowerPC BCJ",
+	0x06: "IA-64 BCJ",
+	0x07: "ARM BCJ",
+	0x08: "ARM-Thumb BCJ",
+	0x09: "SPARC BCJ",
+	0x0a: "ARM64 BCJ",
+	0x0b: "RISC-V BCJ",
+}
+
+func Compression(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return "gzip"
+	case bytes.HasPrefix(data, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return "zstd"
+	case bytes.HasPrefix(data, []byte{0xfd, '7', 'z', 'X', 'Z', 0}):
+		return "xz"
+	case bytes.HasPrefix(data, []byte{0x5d, 0, 0}):
+		return "lzma"
+	case len(data) >= 4 && binary.LittleEndian.Uint32(data) == lz4LegacyMagic:
+		return "lz4"
+	case len(data) >= 4 && binary.LittleEndian.Uint32(data) == lz4FrameMagic:
+		return "lz4"
+	}
+
+	return ""
+}
+
+func Decompress(compression string, data []byte) ([]byte, error) {
+	var reader io.Reader
+	var err error
+
+	switch compression {
+	case "", "none":
+		return data, nil
+	case "gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(data))
+	case "zstd":
+		var decoder *zstd.Decoder
+		if decoder, err = zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(1<<31)); err == nil {
+			defer decoder.Close()
+			reader = decoder
+		}
+	case "xz":
+		if err := xzFilters(data); err != nil {
+			return nil, err
+		}
+
+		reader, err = xz.NewReader(bytes.NewReader(data))
+	case "lzma":
+		reader, err = lzma.NewReader(bytes.NewReader(data))
+	case "lz4":
+		return decompressLz4(data)
+	default:
+		return nil, fmt.Errorf("compression %s is not supported", compression)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", compression, err)
+	}
+
+	out, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", compression, err)
+	}
+
+	return out, nil
+}
+
+func xzFilters(data []byte) error {
+	if len(data) <= xzStreamHeader || data[xzStreamHeader] == 0 {
+		return nil
+	}
+
+	size := (int(data[xzStreamHeader]) + 1) * 4
+	if len(data) < xzStreamHeader+size {
+		return nil
+	}
+
+	header := data[xzStreamHeader+1 : xzStreamHeader+size]
+	flags := header[0]
+	header = header[1:]
+	for _, bit := range []byte{0x40, 0x80} {
+		if flags&bit != 0 {
+			_, n := binary.Uvarint(header)
+			if n <= 0 {
+				return nil
+			}
+
+			header = header[n:]
+		}
+	}
+
+	for range int(flags&3) + 1 {
+		id, n := binary.Uvarint(header)
+		if n <= 0 {
+			return nil
+		}
+
+		if id != xzFilterLzma2 {
+			name, ok := xzFilterNames[id]
+			if !ok {
+				name = fmt.Sprintf("0x%x", id)
+			}
+
+			return fmt.Errorf("unsupported xz filter %s, only LZMA2 is supported", name)
+		}
+
+		props, m := binary.Uvarint(header[n:])
+		if m <= 0 || props > uint64(len(header)-n-m) {
+			return nil
+		}
+
+		header = header[n+m+int(props):]
+	}
+
+	return nil
+}
+
+func decompressLz4(data []byte) ([]byte, error) {
+	out := []byte{}
+	for len(data) >= 4 {
+		var err error
+		switch binary.LittleEndian.Uint32(data) {
+		case lz4LegacyMagic:
+			out, data, err = lz4Legacy(out, data[4:])
+		case lz4FrameMagic:
+			out, data, err = lz4Frame(out, data[4:])
+		default:
+			return out, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+func lz4Legacy(out []byte, data []byte) ([]byte, []byte, error) {
+	for len(data) >= 4 {
+		size := int(binary.LittleEndian.Uint32(data))
+		if size == lz4LegacyMagic || size == lz4FrameMagic {
+			return out, data, nil
+		}
+
+		if len(data) == 4 {
+			return out, nil, nil
+		}
+
+		if size > len(data)-4 || size > lz4LegacyBlock+lz4LegacyBlock/255+16 {
+			return nil, nil, errLz4Corrupt
+		}
+
+		var err error
+		if out, err = lz4Block(out, data[4:4+size]); err != nil {
+			return nil, nil, err
+		}
+
+		data = data[4+size:]
+	}
+
+	if len(data) > 0 {
+		return nil, nil, errLz4Corrupt
+	}
+
+	return out, nil, nil
+}
+
+func lz4Frame(out []byte, data []byte) ([]byte, []byte, error) {
+	if len(data) < 3 || data[0]>>6 != 1 {
+		return nil, nil, errLz4Corrupt
+	}
+
+	flags := data[0]
+	header := 3
+	if flags&0x08 != 0 {
+		header += 8
+	}
+
+	if flags&0x01 != 0 {
+		header += 4
+	}
+
+	if len(data) < header {
+		return nil, nil, errLz4Corrupt
+	}
+
+	data = data[header:]
+	for {
+		if len(data) < 4 {
+			return nil, nil, errLz4Corrupt
+		}
+
+		size := binary.LittleEndian.Uint32(data)
+		data = data[4:]
+		if size == 0 {
+			break
+		}
+
+		n := int(size &^ (1 << 31))
+		if n > len(data) {
+			return nil, nil, errLz4Corrupt
+		}
+
+		if size&(1<<31) != 0 {
+			out = append(out, data[:n]...)
+		} else {
+			var err error
+			if out, err = lz4Block(out, data[:n]); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		data = data[n:]
+		if flags&0x10 != 0 {
+			if len(data) < 4 {
+				return nil, nil, errLz4Corrupt
+			}
+
+			data = data[4:]
+		}
+	}
+
+	if flags&0x04 != 0 {
+		if len(data) < 4 {
+			return nil, nil, errLz4Corrupt
+		}
+
+		data = data[4:]
+	}
+
+	return out, data, nil
+}
+
+func lz4Length(n int, data []byte, i int) (int, int, error) {
+	if n != 15 {
+		return n, i, nil
+	}
+
+	for {
+		if i >= len(data) {
+			return 0, 0, errLz4Corrupt
+		}
+
+		b := data[i]
+		i++
+		n += int(b)
+		if b != 255 {
+			return n, i, nil
+		}
+	}
+}
+
+func lz4Block(out []byte, data []byte) ([]byte, error) {
+	for i := 0; i < len(data); {
+		token := data[i]
+		i++
+
+		literals, next, err := lz4Length(int(token>>4), data, i)
+		if err != nil {
+			return nil, err
+		}
+
+		i = next
+		if i+literals > len(data) {
+			return nil, errLz4Corrupt
+		}
+
+		out = append(out, data[i:i+literals]...)
+		i += literals
+		if i == len(data) {
+			break
+		}
+
+		if i+2 > len(data) {
+			return nil, errLz4Corrupt
+		}
+
+		offset := int(data[i]) | int(data[i+1])<<8
+		i += 2
+
+		match, next, err := lz4Length(int(token&15), data, i)
+		if err != nil {
+			return nil, err
+		}
+
+		i = next
+		match += 4
+		if offset == 0 || offset > len(out) {
+			return nil, errLz4Corrupt
+		}
+
+		from := len(out) - offset
+		for match > 0 {
+			n := min(match, offset)
+			out = append(out, out[from:from+n]...)
+			from += n
+			match -= n
+		}
+	}
+
+	return out, nil
+}
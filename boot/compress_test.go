@@ -0,0 +1,172 @@
+package boot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+const (
+	testLz4Frame  = "04224d186440a70f0000006868656c6c6f2006005068656c6c6f00000000f26b940b"
+	testLz4Legacy = "02214c180f0000006868656c6c6f2006005068656c6c6f"
+	testXzArm64   = "fd377a585a000004e6d6b44604c113170a0021011600000000000000a942ad31e00016000b5d00341949ee8de9560ab5e00000008943dbea0334e4d000012f17810849b11fb6f37d010000000004595a"
+)
+
+func mustHex(s string) []byte {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return data
+}
+
+func compress(t *testing.T, compression string, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	switch compression {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zstd":
+		w, err = zstd.NewWriter(&buf)
+	case "xz":
+		w, err = xz.NewWriter(&buf)
+	case "lzma":
+		w, err = lzma.NewWriter(&buf)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	data := []byte(strings.Repeat("sideboot kernel payload ", 1000))
+	for _, compression := range []string{"gzip", "zstd", "xz", "lzma"} {
+		t.Run(compression, func(t *testing.T) {
+			compressed := compress(t, compression, data)
+			if got := Compression(compressed); got != compression {
+				t.Fatalf("Compression = %q", got)
+			}
+
+			out, err := Decompress(compression, compressed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(out, data) {
+				t.Errorf("got %d bytes, want %d", len(out), len(data))
+			}
+		})
+	}
+}
+
+func TestDecompressLz4(t *testing.T) {
+	want := "hello hello hello hello"
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"frame", mustHex(testLz4Frame), want},
+		{"legacy", mustHex(testLz4Legacy), want},
+		{"concatenated frames", append(mustHex(testLz4Frame), mustHex(testLz4Frame)...), want + want},
+		{"legacy with trailer", append(mustHex(testLz4Legacy), 0x17, 0, 0, 0), want},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Compression(test.data); got != "lz4" {
+				t.Fatalf("Compression = %q", got)
+			}
+
+			out, err := Decompress("lz4", test.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(out) != test.want {
+				t.Errorf("got %q, want %q", out, test.want)
+			}
+		})
+	}
+}
+
+func TestDecompressLz4Corrupt(t *testing.T) {
+	frame, legacy := mustHex(testLz4Frame), mustHex(testLz4Legacy)
+	block := func(b ...byte) []byte {
+		return append([]byte{0x02, 0x21, 0x4c, 0x18, byte(len(b)), 0, 0, 0}, b...)
+	}
+
+	for name, data := range map[string][]byte{
+		"truncated frame":    frame[:12],
+		"frame version":      append([]byte{0x04, 0x22, 0x4d, 0x18, 0x24}, frame[5:]...),
+		"block too long":     append(append([]byte{}, frame[:7]...), 0xff, 0xff, 0, 0, 'h'),
+		"zero offset":        block(0x10, 'a', 0, 0),
+		"offset past output": block(0x10, 'a', 2, 0),
+		"literals past end":  block(0x50, 'a'),
+		"truncated offset":   block(0x10, 'a', 1),
+		"truncated length":   block(0xf0),
+		"truncated legacy":   legacy[:len(legacy)-3],
+		"oversized block":    append(append([]byte{}, legacy[:4]...), 0xff, 0xff, 0xff, 0x7f, 0, 0, 0, 0),
+		"legacy tail":        append(append([]byte{}, legacy...), 0x17, 0),
+	} {
+		if _, err := Decompress("lz4", data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestDecompressXzFilter(t *testing.T) {
+	_, err := Decompress("xz", mustHex(testXzArm64))
+	if err == nil || !strings.Contains(err.Error(), "unsupported xz filter ARM64 BCJ") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{[]byte{0x1f, 0x8b, 0x08}, "gzip"},
+		{[]byte{0x28, 0xb5, 0x2f, 0xfd}, "zstd"},
+		{[]byte{0xfd, '7', 'z', 'X', 'Z', 0}, "xz"},
+		{[]byte{0x5d, 0, 0, 0x80}, "lzma"},
+		{[]byte{0x02, 0x21, 0x4c, 0x18}, "lz4"},
+		{[]byte{0x04, 0x22, 0x4d, 0x18}, "lz4"},
+		{[]byte("BZh9"), ""},
+		{[]byte{0x1f}, ""},
+		{nil, ""},
+	}
+
+	for _, test := range tests {
+		if got := Compression(test.data); got != test.want {
+			t.Errorf("Compression(%x) = %q, want %q", test.data, got, test.want)
+		}
+	}
+
+	if _, err := Decompress("bzip2", nil); err == nil {
+		t.Error("bzip2: expected an error")
+	}
+}
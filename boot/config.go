@@ -0,0 +1,222 @@
+package boot
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+)
+
+type Entry struct {
+	Name      string
+	Title     string
+	Partition string
+	Kernel    string
+	Vendor    string
+	Ramdisks  []string
+	Cmdline   string
+	Dtb       string
+	DtbDir    string
+	Overlays  []string
+	Files     []InitrdFile
+}
+
+func (e Entry) Label() string {
+	if e.Title != "" {
+		return e.Title
+	}
+
+	return e.Name
+}
+
+type Config struct {
+	Default string
+	Timeout int
+	Options []string
+	Entries []Entry
+}
+
+func (c *Config) Lookup(name string) (Entry, bool) {
+	for _, entry := range c.Entries {
+		if entry.Name == name {
+			return entry, true
+		}
+	}
+
+	if index, err := strconv.Atoi(name); err == nil && index >= 0 && index < len(c.Entries) {
+		return c.Entries[index], true
+	}
+
+	return Entry{}, false
+}
+
+func (c *Config) DefaultEntry() (Entry, bool) {
+	if entry, ok := c.Lookup(c.Default); ok {
+		return entry, true
+	}
+
+	if len(c.Entries) == 0 {
+		return Entry{}, false
+	}
+
+	return c.Entries[0], true
+}
+
+func (c *Config) Merge(other *Config) {
+	if c.Default == "" {
+		c.Default = other.Default
+	}
+
+	if c.Timeout == 0 {
+		c.Timeout = other.Timeout
+	}
+
+	c.Options = append(c.Options, other.Options...)
+	c.Entries = append(c.Entries, other.Entries...)
+}
+
+func ParseFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(string(data))
+}
+
+func Parse(data string) (*Config, error) {
+	if isEntryFormat(data) {
+		return parseEntries(data)
+	}
+
+	words, err := shellquote.Split(strings.ReplaceAll(stripComments(data), "\n", " "))
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	for _, word := range words {
+		if isOption(word) {
+			word = strings.TrimPrefix(word, "--")
+		}
+
+		cfg.Options = append(cfg.Options, word)
+	}
+
+	return cfg, nil
+}
+
+func isEntryFormat(data string) bool {
+	for _, line := range strings.Split(stripComments(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && (fields[0] == "entry" || fields[0] == "default" || fields[0] == "timeout") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseEntries(data string) (*Config, error) {
+	cfg := &Config{}
+	var entry *Entry
+
+	for n, line := range strings.Split(stripComments(data), "\n") {
+		words, err := shellquote.Split(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+
+		if len(words) == 0 {
+			continue
+		}
+
+		for _, word := range words {
+			if isOption(word) != isOption(words[0]) {
+				return nil, fmt.Errorf("line %d: sideboot options and other keys can't share a line", n+1)
+			}
+		}
+
+		if isOption(words[0]) {
+			for _, word := range words {
+				cfg.Options = append(cfg.Options, strings.TrimPrefix(word, "--"))
+			}
+
+			continue
+		}
+
+		key, values := words[0], words[1:]
+		value := strings.Join(values, " ")
+
+		if key == "entry" {
+			if value == "" {
+				return nil, fmt.Errorf("line %d: entry requires a name", n+1)
+			}
+
+			cfg.Entries = append(cfg.Entries, Entry{Name: value})
+			entry = &cfg.Entries[len(cfg.Entries)-1]
+			continue
+		}
+
+		if entry == nil {
+			switch key {
+			case "default":
+				cfg.Default = value
+			case "timeout":
+				if cfg.Timeout, err = strconv.Atoi(value); err != nil {
+					return nil, fmt.Errorf("line %d: timeout '%s' is not a number", n+1, value)
+				}
+			default:
+				return nil, fmt.Errorf("line %d: unknown global key '%s'", n+1, key)
+			}
+
+			continue
+		}
+
+		switch key {
+		case "title":
+			entry.Title = value
+		case "kernel":
+			entry.Kernel = value
+		case "vendorboot":
+			entry.Vendor = value
+		case "ramdisk":
+			entry.Ramdisks = append(entry.Ramdisks, values...)
+		case "cmdline":
+			entry.Cmdline = value
+		case "dtb":
+			entry.Dtb = value
+		case "dtbdir":
+			entry.DtbDir = value
+		case "overlays":
+			entry.Overlays = append(entry.Overlays, values...)
+		case "initrdfile":
+			if len(values) != 2 {
+				return nil, fmt.Errorf("line %d: initrdfile needs a target and a source", n+1)
+			}
+
+			entry.Files = append(entry.Files, InitrdFile{Target: values[0], Source: values[1]})
+		default:
+			return nil, fmt.Errorf("line %d: unknown key '%s' in entry %s", n+1, key, entry.Name)
+		}
+	}
+
+	return cfg, nil
+}
+
+func isOption(word string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(word, "--"), "sideboot.")
+}
+
+func stripComments(data string) string {
+	lines := strings.Split(data, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			lines[i] = ""
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,144 @@
+package boot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLegacy(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{
+			name: "flat options",
+			data: "--sideboot.shell=0\n--sideboot.kernel=vmlinuz \n--sideboot.ramdisk=initramfs \n--sideboot.cmdline='console=tty1 quiet'\n",
+			want: []string{"sideboot.shell=0", "sideboot.kernel=vmlinuz", "sideboot.ramdisk=initramfs", "sideboot.cmdline=console=tty1 quiet"},
+		},
+		{
+			name: "single line",
+			data: "sideboot.kernel=vmlinuz sideboot.ramdisk=initramfs",
+			want: []string{"sideboot.kernel=vmlinuz", "sideboot.ramdisk=initramfs"},
+		},
+		{
+			name: "other words",
+			data: "# boot options\nsideboot.kernel=vmlinuz quiet\nloglevel=1",
+			want: []string{"sideboot.kernel=vmlinuz", "quiet", "loglevel=1"},
+		},
+		{
+			name: "empty",
+			data: "\n# nothing\n",
+			want: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := Parse(test.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(cfg.Options, test.want) {
+				t.Errorf("options = %q, want %q", cfg.Options, test.want)
+			}
+
+			if len(cfg.Entries) != 0 {
+				t.Errorf("unexpected entries %+v", cfg.Entries)
+			}
+		})
+	}
+}
+
+func TestParseEntries(t *testing.T) {
+	data := `default testing
+timeout 5
+sideboot.shell=0 --sideboot.rootwait=20
+
+entry stable
+  title 'postmarketOS'
+  kernel vmlinuz
+  ramdisk initramfs extra.img
+  cmdline 'console=tty1 quiet'
+
+# testing kernel
+entry testing
+  kernel vmlinuz-testing
+  ramdisk initramfs
+  dtb qcom/sc7180-trogdor-lazor-r3.dtb
+  overlays a.dtbo b.dtbo
+  initrdfile /lib/firmware firmware
+sideboot.dtbdir=dtbs
+`
+
+	cfg, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Default != "testing" || cfg.Timeout != 5 {
+		t.Errorf("default = %q, timeout = %d", cfg.Default, cfg.Timeout)
+	}
+
+	if want := []string{"sideboot.shell=0", "sideboot.rootwait=20", "sideboot.dtbdir=dtbs"}; !reflect.DeepEqual(cfg.Options, want) {
+		t.Errorf("options = %q, want %q", cfg.Options, want)
+	}
+
+	want := []Entry{
+		{Name: "stable", Title: "postmarketOS", Kernel: "vmlinuz", Ramdisks: []string{"initramfs", "extra.img"}, Cmdline: "console=tty1 quiet"},
+		{
+			Name:     "testing",
+			Kernel:   "vmlinuz-testing",
+			Ramdisks: []string{"initramfs"},
+			Dtb:      "qcom/sc7180-trogdor-lazor-r3.dtb",
+			Overlays: []string{"a.dtbo", "b.dtbo"},
+			Files:    []InitrdFile{{Target: "/lib/firmware", Source: "firmware"}},
+		},
+	}
+
+	if !reflect.DeepEqual(cfg.Entries, want) {
+		t.Errorf("entries = %+v, want %+v", cfg.Entries, want)
+	}
+
+	if entry, ok := cfg.DefaultEntry(); !ok || entry.Name != "testing" {
+		t.Errorf("default entry = %+v", entry)
+	}
+}
+
+func TestParseEntriesErrors(t *testing.T) {
+	for _, data := range []string{
+		"timeout soon",
+		"default a\ncolor red",
+		"default a\nentry",
+		"entry a\n  kernel vmlinuz\n  color red",
+		"entry a\n  initrdfile /lib/firmware",
+		"entry a\n  cmdline 'quiet",
+		"default a\nsideboot.kernel=vmlinuz quiet",
+		"entry a\n  kernel vmlinuz sideboot.ramdisk=initramfs",
+	} {
+		if _, err := Parse(data); err == nil {
+			t.Errorf("%q: expected an error", data)
+		}
+	}
+}
+
+func TestConfigLookup(t *testing.T) {
+	cfg := &Config{Entries: []Entry{{Name: "a"}, {Name: "b"}}}
+	for name, want := range map[string]string{"a": "a", "b": "b", "1": "b", "0": "a"} {
+		if entry, ok := cfg.Lookup(name); !ok || entry.Name != want {
+			t.Errorf("Lookup(%q) = %+v", name, entry)
+		}
+	}
+
+	for _, name := range []string{"c", "2", "-1", ""} {
+		if _, ok := cfg.Lookup(name); ok {
+			t.Errorf("Lookup(%q) found an entry", name)
+		}
+	}
+
+	cfg.Default = "missing"
+	if entry, ok := cfg.DefaultEntry(); !ok || entry.Name != "a" {
+		t.Errorf("default entry = %+v", entry)
+	}
+}
@@ -0,0 +1,75 @@
+package boot
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	osReleaseFiles = []string{"etc/os-release", "usr/lib/os-release"}
+	kernelDirs     = []string{".", "boot"}
+	kernelNames    = []string{"vmlinuz", "Image", "zImage"}
+	ramdiskNames   = []string{"initramfs%s", "initramfs%s.img", "initrd.img%s", "initrd%s", "initrd%s.img"}
+)
+
+func OSName(root string) string {
+	for _, name := range osReleaseFiles {
+		data, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			continue
+		}
+
+		osrel := parseOSRelease(string(data))
+		if osrel["PRETTY_NAME"] != "" {
+			return osrel["PRETTY_NAME"]
+		}
+
+		if osrel["NAME"] != "" {
+			return osrel["NAME"]
+		}
+	}
+
+	return ""
+}
+
+func ScanKernels(root string) (*Config, error) {
+	cfg := &Config{}
+	for _, dir := range kernelDirs {
+		for _, name := range kernelNames {
+			files, _ := filepath.Glob(filepath.Join(root, dir, name))
+			versioned, _ := filepath.Glob(filepath.Join(root, dir, name+"-*"))
+			sort.SliceStable(versioned, func(i, j int) bool {
+				return CompareVersions(versioned[i], versioned[j]) > 0
+			})
+
+			for _, file := range append(files, versioned...) {
+				kernel, _ := filepath.Rel(root, file)
+				if strings.HasSuffix(kernel, ".old") || strings.HasSuffix(kernel, ".bak") {
+					continue
+				}
+
+				entry := Entry{Name: kernel, Title: kernel, Kernel: kernel}
+				if ramdisk := findRamdisk(root, filepath.Dir(kernel), strings.TrimPrefix(filepath.Base(kernel), name)); ramdisk != "" {
+					entry.Ramdisks = []string{ramdisk}
+				}
+
+				cfg.Entries = append(cfg.Entries, entry)
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+func findRamdisk(root string, dir string, version string) string {
+	for _, pattern := range ramdiskNames {
+		name := filepath.Join(dir, strings.Replace(pattern, "%s", version, 1))
+		if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+			return name
+		}
+	}
+
+	return ""
+}
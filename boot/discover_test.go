@@ -0,0 +1,59 @@
+package boot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOSName(t *testing.T) {
+	tests := []struct {
+		files map[string]string
+		want  string
+	}{
+		{map[string]string{"etc/os-release": "NAME=\"Arch Linux\"\nPRETTY_NAME=\"Arch Linux ARM\"\n"}, "Arch Linux ARM"},
+		{map[string]string{"usr/lib/os-release": "NAME=postmarketOS\nVERSION_ID=v24.06\n"}, "postmarketOS"},
+		{map[string]string{"etc/os-release": "ID=alpine\n", "usr/lib/os-release": "NAME=Alpine\n"}, "Alpine"},
+		{map[string]string{"etc/hostname": "lazor\n"}, ""},
+	}
+
+	for _, test := range tests {
+		if got := OSName(writeTestFiles(t, test.files)); got != test.want {
+			t.Errorf("%v: got %q, want %q", test.files, got, test.want)
+		}
+	}
+}
+
+func TestScanKernels(t *testing.T) {
+	root := writeTestFiles(t, map[string]string{
+		"vmlinuz":                  "kernel",
+		"initramfs":                "initramfs",
+		"boot/vmlinuz-6.9.1":       "kernel",
+		"boot/vmlinuz-6.10.2":      "kernel",
+		"boot/vmlinuz-6.10.2.old":  "kernel",
+		"boot/initrd.img-6.10.2":   "initramfs",
+		"boot/initramfs-6.9.1.img": "initramfs",
+		"boot/Image":               "kernel",
+		"boot/Image.bak":           "kernel",
+		"boot/config-6.10.2":       "config",
+	})
+
+	cfg, err := ScanKernels(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Entry{
+		{Name: "vmlinuz", Title: "vmlinuz", Kernel: "vmlinuz", Ramdisks: []string{"initramfs"}},
+		{Name: "boot/vmlinuz-6.10.2", Title: "boot/vmlinuz-6.10.2", Kernel: "boot/vmlinuz-6.10.2", Ramdisks: []string{"boot/initrd.img-6.10.2"}},
+		{Name: "boot/vmlinuz-6.9.1", Title: "boot/vmlinuz-6.9.1", Kernel: "boot/vmlinuz-6.9.1", Ramdisks: []string{"boot/initramfs-6.9.1.img"}},
+		{Name: "boot/Image", Title: "boot/Image", Kernel: "boot/Image"},
+	}
+
+	if !reflect.DeepEqual(cfg.Entries, want) {
+		t.Errorf("got %+v\nwant %+v", cfg.Entries, want)
+	}
+
+	if cfg, err := ScanKernels(t.TempDir()); err != nil || len(cfg.Entries) != 0 {
+		t.Errorf("empty root: got %+v, %v", cfg, err)
+	}
+}
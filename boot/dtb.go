@@ -0,0 +1,68 @@
+package boot
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"sideboot/fdt"
+)
+
+const (
+	DtbAuto    = "auto"
+	DtbRunning = "running"
+)
+
+var dtbDirs = []string{"dtbs", "dtb", "boot/dtbs", "boot/dtb", "dtb-*", "boot/dtb-*"}
+
+func DtbDirs(root string) []string {
+	dirs := []string{}
+	for _, pattern := range dtbDirs {
+		matches, _ := filepath.Glob(filepath.Join(root, pattern))
+		for _, match := range matches {
+			if rel, err := filepath.Rel(root, match); err == nil {
+				dirs = append(dirs, rel)
+			}
+		}
+	}
+
+	return dirs
+}
+
+func FindDtb(dirs []string, machine []string) (string, string, error) {
+	if len(machine) == 0 {
+		return "", "", errors.New("machine compatible is unknown")
+	}
+
+	best, score := "", len(machine)
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(path, ".dtb") {
+				return nil
+			}
+
+			tree, err := fdt.Load(path)
+			if err != nil {
+				return nil
+			}
+
+			if s := fdt.Score(tree.Root.Strings("compatible"), machine); s >= 0 && s < score {
+				best, score = path, s
+			}
+
+			return nil
+		})
+
+		if score == 0 {
+			break
+		}
+	}
+
+	if best == "" {
+		return "", "", fmt.Errorf("no device tree in %s matches %s", strings.Join(dirs, ", "), machine[0])
+	}
+
+	return best, "compatible " + machine[score], nil
+}
@@ -0,0 +1,77 @@
+package boot
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTestDtb(t *testing.T, path string, compatible ...string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	root := &testNode{props: []testProp{{"compatible", testStrings(compatible...)}}}
+	if err := os.WriteFile(path, testFDT(root), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindDtb(t *testing.T) {
+	root := t.TempDir()
+	writeTestDtb(t, filepath.Join(root, "dtbs/qcom/sc7180-trogdor-lazor-r3.dtb"), "google,lazor-rev3", "google,lazor", "qcom,sc7180")
+	writeTestDtb(t, filepath.Join(root, "dtbs/qcom/sc7180-trogdor-kingoftown.dtb"), "google,kingoftown", "qcom,sc7180")
+	writeTestDtb(t, filepath.Join(root, "dtbs/qcom/sc7180-idp.dtb"), "qcom,sc7180-idp", "qcom,sc7180")
+	writeTestDtb(t, filepath.Join(root, "boot/dtb-6.6/rockchip/rk3399-pinebook-pro.dtb"), "pine64,pinebook-pro", "rockchip,rk3399")
+	os.WriteFile(filepath.Join(root, "dtbs/qcom/broken.dtb"), []byte("not a device tree"), 0o644)
+	os.WriteFile(filepath.Join(root, "dtbs/qcom/README"), []byte("google,lazor-rev3"), 0o644)
+
+	dirs := DtbDirs(root)
+	if want := []string{"dtbs", "boot/dtb-6.6"}; !reflect.DeepEqual(dirs, want) {
+		t.Fatalf("DtbDirs = %q, want %q", dirs, want)
+	}
+
+	for i := range dirs {
+		dirs[i] = filepath.Join(root, dirs[i])
+	}
+
+	tests := []struct {
+		name    string
+		machine []string
+		want    string
+		reason  string
+	}{
+		{"exact", []string{"google,lazor-rev3", "google,lazor", "qcom,sc7180"}, "dtbs/qcom/sc7180-trogdor-lazor-r3.dtb", "compatible google,lazor-rev3"},
+		{"board family", []string{"google,lazor-rev9", "google,lazor", "qcom,sc7180"}, "dtbs/qcom/sc7180-trogdor-lazor-r3.dtb", "compatible google,lazor"},
+		{"other directory", []string{"pine64,pinebook-pro", "rockchip,rk3399"}, "boot/dtb-6.6/rockchip/rk3399-pinebook-pro.dtb", "compatible pine64,pinebook-pro"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dtb, reason, err := FindDtb(dirs, test.machine)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if dtb != filepath.Join(root, test.want) || reason != test.reason {
+				t.Errorf("got %s (%s), want %s (%s)", dtb, reason, test.want, test.reason)
+			}
+		})
+	}
+
+	dtb, _, err := FindDtb(dirs, []string{"google,pompom", "qcom,sc7180"})
+	if err != nil || filepath.Dir(dtb) != filepath.Join(root, "dtbs/qcom") {
+		t.Errorf("SoC fallback: got %s, %v", dtb, err)
+	}
+
+	if _, _, err := FindDtb(dirs, []string{"vendor,unknown"}); err == nil {
+		t.Error("no match: expected an error")
+	}
+
+	if _, _, err := FindDtb(dirs, nil); err == nil {
+		t.Error("unknown machine: expected an error")
+	}
+}
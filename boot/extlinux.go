@@ -0,0 +1,141 @@
+package boot
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var extlinuxFiles = []string{
+	"extlinux/extlinux.conf",
+	"boot/extlinux/extlinux.conf",
+	"syslinux/syslinux.cfg",
+	"boot/syslinux/syslinux.cfg",
+}
+
+func ScanExtlinux(root string) (*Config, error) {
+	for _, name := range extlinuxFiles {
+		cfg, err := ParseExtlinuxFile(root, name)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		return cfg, err
+	}
+
+	return &Config{}, nil
+}
+
+func ParseExtlinuxFile(root string, name string) (*Config, error) {
+	f, err := os.Open(filepath.Join(root, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg := &Config{}
+	dir := path.Dir("/" + name)
+	var entry *Entry
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value := cutSpace(line)
+		key = strings.ToLower(key)
+
+		if key == "menu" {
+			var sub string
+			sub, value = cutSpace(value)
+			key = "menu " + strings.ToLower(sub)
+		}
+
+		if key == "label" {
+			cfg.Entries = append(cfg.Entries, Entry{Name: value, Title: value})
+			entry = &cfg.Entries[len(cfg.Entries)-1]
+			continue
+		}
+
+		switch key {
+		case "default":
+			cfg.Default = value
+			continue
+		case "timeout":
+			timeout, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: timeout '%s' is not a number", name, n, value)
+			}
+
+			cfg.Timeout = (timeout + 9) / 10
+			continue
+		case "menu title", "menu background", "menu hidden", "prompt", "ontimeout", "totaltimeout", "say", "ui":
+			continue
+		case "include":
+			log.Printf("extlinux: %s:%d: include is not supported", name, n)
+			continue
+		}
+
+		if entry == nil {
+			log.Printf("extlinux: %s:%d: %s outside of label", name, n, key)
+			continue
+		}
+
+		switch key {
+		case "menu label":
+			entry.Title = value
+		case "kernel", "linux":
+			entry.Kernel = extlinuxPath(dir, value)
+		case "initrd":
+			for _, initrd := range strings.Split(value, ",") {
+				entry.Ramdisks = append(entry.Ramdisks, extlinuxPath(dir, initrd))
+			}
+		case "fdt", "devicetree":
+			entry.Dtb = extlinuxPath(dir, value)
+		case "fdtdir", "devicetreedir":
+			entry.DtbDir = extlinuxPath(dir, value)
+		case "fdtoverlays", "devicetree-overlay":
+			for _, overlay := range strings.Fields(value) {
+				entry.Overlays = append(entry.Overlays, extlinuxPath(dir, overlay))
+			}
+		case "append":
+			entry.Cmdline = value
+		case "menu default":
+			cfg.Default = entry.Name
+		case "localboot":
+			log.Printf("extlinux: %s:%d: localboot entry %s is not supported", name, n, entry.Name)
+		default:
+			log.Printf("extlinux: %s:%d: unknown keyword %s", name, n, key)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	entries := cfg.Entries[:0]
+	for _, entry := range cfg.Entries {
+		if entry.Kernel != "" {
+			entries = append(entries, entry)
+		}
+	}
+	cfg.Entries = entries
+
+	return cfg, nil
+}
+
+func extlinuxPath(dir string, value string) string {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "/") {
+		return bootPath(value)
+	}
+
+	return bootPath(path.Join(dir, value))
+}
@@ -0,0 +1,102 @@
+package boot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseExtlinux(t *testing.T) {
+	root := writeTestFiles(t, map[string]string{"boot/extlinux/extlinux.conf": `# Generated by u-boot-update
+MENU TITLE Boot menu
+Timeout 35
+Default l1
+PROMPT 0
+
+LABEL l0
+	MENU LABEL Debian GNU/Linux 6.1.0-18-arm64
+	LINUX /vmlinuz-6.1.0-18-arm64
+	INITRD /initrd.img-6.1.0-18-arm64
+	FDT /dtbs/6.1.0-18-arm64/rockchip/rk3399-pinebook-pro.dtb
+	APPEND root=UUID=1234 ro quiet
+
+label l1
+	menu label Debian GNU/Linux 6.1.0-17-arm64 (rescue)
+	kernel ../vmlinuz-6.1.0-17-arm64
+	initrd ../initrd.img-6.1.0-17-arm64,../firmware.cpio
+	fdtdir ../dtbs/6.1.0-17-arm64/
+	append root=UUID=1234 ro single
+
+Label memtest
+	Kernel memtest.bin
+	Menu Default
+
+label local
+	localboot 0
+	menu label Boot from the next device
+`})
+
+	cfg, err := ScanExtlinux(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Entry{
+		{
+			Name:     "l0",
+			Title:    "Debian GNU/Linux 6.1.0-18-arm64",
+			Kernel:   "vmlinuz-6.1.0-18-arm64",
+			Ramdisks: []string{"initrd.img-6.1.0-18-arm64"},
+			Dtb:      "dtbs/6.1.0-18-arm64/rockchip/rk3399-pinebook-pro.dtb",
+			Cmdline:  "root=UUID=1234 ro quiet",
+		},
+		{
+			Name:     "l1",
+			Title:    "Debian GNU/Linux 6.1.0-17-arm64 (rescue)",
+			Kernel:   "boot/vmlinuz-6.1.0-17-arm64",
+			Ramdisks: []string{"boot/initrd.img-6.1.0-17-arm64", "boot/firmware.cpio"},
+			DtbDir:   "boot/dtbs/6.1.0-17-arm64",
+			Cmdline:  "root=UUID=1234 ro single",
+		},
+		{Name: "memtest", Title: "memtest", Kernel: "boot/extlinux/memtest.bin"},
+	}
+
+	if !reflect.DeepEqual(cfg.Entries, want) {
+		t.Errorf("got %+v\nwant %+v", cfg.Entries, want)
+	}
+
+	if cfg.Default != "memtest" || cfg.Timeout != 4 {
+		t.Errorf("default = %q, timeout = %d", cfg.Default, cfg.Timeout)
+	}
+}
+
+func TestParseExtlinuxDefault(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		def     string
+		timeout int
+	}{
+		{"syslinux/syslinux.cfg", "DEFAULT linux\nLABEL linux\nKERNEL /vmlinuz\nTIMEOUT 10", "linux", 1},
+		{"extlinux/extlinux.conf", "label a\nlinux /a\nlabel b\nlinux /b\nmenu default\ndefault a", "a", 0},
+		{"extlinux/extlinux.conf", "timeout 0\nlabel a\nlinux /a", "", 0},
+	}
+
+	for _, test := range tests {
+		cfg, err := ScanExtlinux(writeTestFiles(t, map[string]string{test.name: test.data}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cfg.Default != test.def || cfg.Timeout != test.timeout {
+			t.Errorf("%q: default = %q, timeout = %d", test.data, cfg.Default, cfg.Timeout)
+		}
+	}
+
+	if _, err := ScanExtlinux(writeTestFiles(t, map[string]string{"extlinux/extlinux.conf": "timeout soon"})); err == nil {
+		t.Error("bad timeout: expected an error")
+	}
+
+	if cfg, err := ScanExtlinux(t.TempDir()); err != nil || len(cfg.Entries) != 0 {
+		t.Errorf("no config: got %+v, %v", cfg, err)
+	}
+}
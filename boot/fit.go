@@ -0,0 +1,325 @@
+package boot
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"sideboot/fdt"
+)
+
+var fitFiles = []string{"*.itb", "*.fit", "boot/*.itb", "boot/*.fit"}
+
+var fitArchitectures = map[string]string{
+	"arm64": "arm64",
+	"arm":   "arm",
+	"amd64": "x86_64",
+	"386":   "x86",
+}
+
+type FITConfig struct {
+	Name        string
+	Description string
+	Compatible  []string
+	Kernel      string
+	Ramdisk     string
+	Fdts        []string
+}
+
+type FIT struct {
+	Description string
+	Default     string
+	Configs     []FITConfig
+	tree        *fdt.Tree
+	data        []byte
+}
+
+func ScanFIT(root string) (*Config, error) {
+	cfg := &Config{}
+	for _, pattern := range fitFiles {
+		files, _ := filepath.Glob(filepath.Join(root, pattern))
+		for _, file := range files {
+			name, _ := filepath.Rel(root, file)
+			fit, err := OpenFIT(file)
+			if err != nil {
+				log.Print("fit: ", err)
+				continue
+			}
+
+			entry := Entry{Name: name, Title: fit.Description, Kernel: name}
+			if entry.Title == "" {
+				entry.Title = name
+			}
+
+			cfg.Entries = append(cfg.Entries, entry)
+		}
+	}
+
+	return cfg, nil
+}
+
+func IsFIT(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false
+	}
+
+	return fdt.IsFDT(magic)
+}
+
+func OpenFIT(path string) (*FIT, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fit, err := ParseFIT(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return fit, nil
+}
+
+func ParseFIT(data []byte) (*FIT, error) {
+	tree, err := fdt.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if tree.Lookup("/images") == nil {
+		return nil, errors.New("device tree has no /images node, not a FIT image")
+	}
+
+	fit := &FIT{
+		Description: tree.Root.String("description"),
+		tree:        tree,
+		data:        data,
+	}
+
+	configs := tree.Lookup("/configurations")
+	if configs == nil {
+		return nil, errors.New("FIT image has no /configurations node")
+	}
+
+	fit.Default = configs.String("default")
+	for _, node := range configs.Children {
+		config := FITConfig{
+			Name:        node.Name,
+			Description: node.String("description"),
+			Compatible:  node.Strings("compatible"),
+			Kernel:      node.String("kernel"),
+			Ramdisk:     node.String("ramdisk"),
+			Fdts:        node.Strings("fdt"),
+		}
+
+		if len(config.Compatible) == 0 && len(config.Fdts) > 0 {
+			if blob, err := fit.Image(config.Fdts[0]); err == nil {
+				if dtb, err := fdt.Parse(blob); err == nil {
+					config.Compatible = dtb.Root.Strings("compatible")
+				}
+			}
+		}
+
+		fit.Configs = append(fit.Configs, config)
+	}
+
+	if len(fit.Configs) == 0 {
+		return nil, errors.New("FIT image has no configurations")
+	}
+
+	return fit, nil
+}
+
+func (f *FIT) Select(machine []string) (FITConfig, string) {
+	best, score := -1, len(machine)
+	for i, config := range f.Configs {
+		if j := fdt.Score(config.Compatible, machine); j >= 0 && j < score {
+			best, score = i, j
+		}
+	}
+
+	if best >= 0 {
+		return f.Configs[best], fmt.Sprintf("compatible %s", machine[score])
+	}
+
+	for _, config := range f.Configs {
+		if config.Name == f.Default {
+			return config, "default configuration"
+		}
+	}
+
+	return f.Configs[0], "first configuration"
+}
+
+func (f *FIT) Image(name string) ([]byte, error) {
+	node := f.imageNode(name)
+	if node == nil {
+		return nil, fmt.Errorf("image %s not found", name)
+	}
+
+	data, ok := node.Property("data")
+	if !ok {
+		size, ok := node.Uint32("data-size")
+		if !ok {
+			return nil, fmt.Errorf("image %s has no data", name)
+		}
+
+		start := int64(0)
+		if position, ok := node.Uint32("data-position"); ok {
+			start = int64(position)
+		} else if offset, ok := node.Uint32("data-offset"); ok {
+			start = int64(f.tree.Size+3)&^3 + int64(offset)
+		} else {
+			return nil, fmt.Errorf("image %s has neither data nor data-offset", name)
+		}
+
+		if start+int64(size) > int64(len(f.data)) {
+			return nil, fmt.Errorf("image %s external data is out of bounds", name)
+		}
+
+		data = f.data[start : start+int64(size)]
+	}
+
+	if err := verifyHashes(node, data); err != nil {
+		return nil, fmt.Errorf("image %s: %w", name, err)
+	}
+
+	data, err := Decompress(node.String("compression"), data)
+	if err != nil {
+		return nil, fmt.Errorf("image %s: %w", name, err)
+	}
+
+	return data, nil
+}
+
+func (f *FIT) imageNode(name string) *fdt.Node {
+	return f.tree.Lookup("/images/" + name)
+}
+
+func verifyHashes(node *fdt.Node, data []byte) error {
+	for _, child := range node.Children {
+		if !strings.HasPrefix(child.Name, "hash") {
+			continue
+		}
+
+		algo := child.String("algo")
+		want, _ := child.Property("value")
+
+		var h hash.Hash
+		switch algo {
+		case "crc32":
+			sum := make([]byte, 4)
+			binary.BigEndian.PutUint32(sum, crc32.ChecksumIEEE(data))
+			if !bytes.Equal(sum, want) {
+				return fmt.Errorf("%s checksum mismatch", algo)
+			}
+
+			continue
+		case "md5":
+			h = md5.New()
+		case "sha1":
+			h = sha1.New()
+		case "sha256":
+			h = sha256.New()
+		case "sha384":
+			h = sha512.New384()
+		case "sha512":
+			h = sha512.New()
+		default:
+			log.Printf("fit: hash algorithm %s is not supported, skipping", algo)
+			continue
+		}
+
+		h.Write(data)
+		if !bytes.Equal(h.Sum(nil), want) {
+			return fmt.Errorf("%s hash mismatch", algo)
+		}
+	}
+
+	return nil
+}
+
+func ExtractFIT(entry Entry, dir string, machine []string) (Entry, error) {
+	path := entry.Kernel
+	fit, err := OpenFIT(path)
+	if err != nil {
+		return entry, err
+	}
+
+	config, reason := fit.Select(machine)
+	log.Printf("fit: %s: using configuration %s (%s)", path, config.Name, reason)
+
+	if config.Kernel == "" {
+		return entry, fmt.Errorf("%s: configuration %s has no kernel", path, config.Name)
+	}
+
+	if node := fit.imageNode(config.Kernel); node != nil {
+		if arch, want := node.String("arch"), fitArchitectures[runtime.GOARCH]; arch != "" && arch != want {
+			return entry, fmt.Errorf("%s: kernel %s is built for %s, not %s", path, config.Kernel, arch, want)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return entry, err
+	}
+
+	extract := func(image string, name string) (string, error) {
+		data, err := fit.Image(image)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", path, err)
+		}
+
+		file := filepath.Join(dir, name)
+		return file, os.WriteFile(file, data, 0o644)
+	}
+
+	if entry.Kernel, err = extract(config.Kernel, "kernel"); err != nil {
+		return entry, err
+	}
+
+	if config.Ramdisk != "" {
+		ramdisk, err := extract(config.Ramdisk, "ramdisk")
+		if err != nil {
+			return entry, err
+		}
+
+		entry.Ramdisks = append([]string{ramdisk}, entry.Ramdisks...)
+	}
+
+	if len(config.Fdts) > 0 && entry.Dtb == "" {
+		if entry.Dtb, err = extract(config.Fdts[0], "fdt"); err != nil {
+			return entry, err
+		}
+
+		for i, image := range config.Fdts[1:] {
+			overlay, err := extract(image, fmt.Sprintf("overlay%d", i))
+			if err != nil {
+				return entry, err
+			}
+
+			entry.Overlays = append(entry.Overlays, overlay)
+		}
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,264 @@
+package boot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testNode struct {
+	name     string
+	props    []testProp
+	children []*testNode
+}
+
+type testProp struct {
+	name  string
+	value []byte
+}
+
+func testStrings(values ...string) []byte {
+	return []byte(strings.Join(values, "\x00") + "\x00")
+}
+
+func testUint32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+func testFDT(root *testNode) []byte {
+	be := binary.BigEndian
+	var structs, names []byte
+	offsets := map[string]int{}
+
+	pad := func() {
+		for len(structs)%4 != 0 {
+			structs = append(structs, 0)
+		}
+	}
+
+	var walk func(n *testNode)
+	walk = func(n *testNode) {
+		structs = be.AppendUint32(structs, 1)
+		structs = append(append(structs, n.name...), 0)
+		pad()
+
+		for _, prop := range n.props {
+			off, ok := offsets[prop.name]
+			if !ok {
+				off = len(names)
+				offsets[prop.name] = off
+				names = append(append(names, prop.name...), 0)
+			}
+
+			structs = be.AppendUint32(structs, 3)
+			structs = be.AppendUint32(structs, uint32(len(prop.value)))
+			structs = be.AppendUint32(structs, uint32(off))
+			structs = append(structs, prop.value...)
+			pad()
+		}
+
+		for _, child := range n.children {
+			walk(child)
+		}
+
+		structs = be.AppendUint32(structs, 2)
+	}
+
+	walk(root)
+	structs = be.AppendUint32(structs, 9)
+
+	header := make([]byte, 56)
+	for i, v := range []uint32{0xd00dfeed, uint32(56 + len(structs) + len(names)), 56, uint32(56 + len(structs)), 40, 17, 16, 0, uint32(len(names)), uint32(len(structs))} {
+		be.PutUint32(header[i*4:], v)
+	}
+
+	return bytes.Join([][]byte{header, structs, names}, nil)
+}
+
+func testImage(name string, data []byte, props ...testProp) *testNode {
+	node := &testNode{name: name, props: append([]testProp{{"data", data}}, props...)}
+	if data == nil {
+		node.props = props
+	}
+
+	return node
+}
+
+func testHash(name string, algo string, value []byte) *testNode {
+	return &testNode{name: name, props: []testProp{{"algo", testStrings(algo)}, {"value", value}}}
+}
+
+func testFIT(t *testing.T, external []byte, images ...*testNode) []byte {
+	t.Helper()
+
+	kernel := []byte("arm64 kernel")
+	kernelSha := sha256.Sum256(kernel)
+	kernelMd5 := md5.Sum(kernel)
+
+	var ramdisk bytes.Buffer
+	w := gzip.NewWriter(&ramdisk)
+	w.Write([]byte("ramdisk"))
+	w.Close()
+
+	dtb := testFDT(&testNode{props: []testProp{{"compatible", testStrings("google,lazor-rev3", "google,lazor", "qcom,sc7180")}}})
+
+	kernelNode := testImage("kernel-1", kernel, testProp{"arch", testStrings("arm64")}, testProp{"compression", testStrings("none")})
+	kernelNode.children = []*testNode{
+		testHash("hash-1", "sha256", kernelSha[:]),
+		testHash("hash-2", "crc32", testUint32(crc32.ChecksumIEEE(kernel))),
+		testHash("hash-3", "md5", kernelMd5[:]),
+		testHash("hash-4", "blake3", []byte("unchecked")),
+	}
+
+	fit := testFDT(&testNode{
+		props: []testProp{{"description", testStrings("test FIT")}},
+		children: []*testNode{
+			{name: "images", children: append([]*testNode{
+				kernelNode,
+				testImage("ramdisk-1", ramdisk.Bytes(), testProp{"compression", testStrings("gzip")}),
+				testImage("fdt-1", dtb),
+			}, images...)},
+			{name: "configurations", props: []testProp{{"default", testStrings("conf-2")}}, children: []*testNode{
+				{name: "conf-1", props: []testProp{
+					{"kernel", testStrings("kernel-1")},
+					{"ramdisk", testStrings("ramdisk-1")},
+					{"fdt", testStrings("fdt-1")},
+				}},
+				{name: "conf-2", props: []testProp{
+					{"description", testStrings("Pinebook Pro")},
+					{"compatible", testStrings("pine64,pinebook-pro", "rockchip,rk3399")},
+					{"kernel", testStrings("kernel-1")},
+				}},
+			}},
+		},
+	})
+
+	for len(fit)%4 != 0 {
+		fit = append(fit, 0)
+	}
+
+	return append(fit, external...)
+}
+
+func TestParseFIT(t *testing.T) {
+	fit, err := ParseFIT(testFIT(t, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []FITConfig{
+		{Name: "conf-1", Compatible: []string{"google,lazor-rev3", "google,lazor", "qcom,sc7180"}, Kernel: "kernel-1", Ramdisk: "ramdisk-1", Fdts: []string{"fdt-1"}},
+		{Name: "conf-2", Description: "Pinebook Pro", Compatible: []string{"pine64,pinebook-pro", "rockchip,rk3399"}, Kernel: "kernel-1"},
+	}
+
+	if fit.Description != "test FIT" || fit.Default != "conf-2" || !reflect.DeepEqual(fit.Configs, want) {
+		t.Errorf("got %q %q %+v", fit.Description, fit.Default, fit.Configs)
+	}
+
+	for name, data := range map[string][]byte{
+		"not a device tree": []byte("not a device tree"),
+		"no images":         testFDT(&testNode{children: []*testNode{{name: "configurations"}}}),
+		"no configurations": testFDT(&testNode{children: []*testNode{{name: "images"}}}),
+		"empty configurations": testFDT(&testNode{children: []*testNode{
+			{name: "images"}, {name: "configurations", props: []testProp{{"default", testStrings("conf-1")}}},
+		}}),
+	} {
+		if _, err := ParseFIT(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSelectFIT(t *testing.T) {
+	fit, err := ParseFIT(testFIT(t, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		machine []string
+		want    string
+		reason  string
+	}{
+		{[]string{"google,lazor-rev9", "google,lazor", "qcom,sc7180"}, "conf-1", "compatible google,lazor"},
+		{[]string{"pine64,pinebook-pro", "rockchip,rk3399"}, "conf-2", "compatible pine64,pinebook-pro"},
+		{[]string{"rockchip,rk3399", "qcom,sc7180"}, "conf-2", "compatible rockchip,rk3399"},
+		{[]string{"vendor,unknown"}, "conf-2", "default configuration"},
+		{nil, "conf-2", "default configuration"},
+	}
+
+	for _, test := range tests {
+		if config, reason := fit.Select(test.machine); config.Name != test.want || reason != test.reason {
+			t.Errorf("%q: got %s (%s), want %s (%s)", test.machine, config.Name, reason, test.want, test.reason)
+		}
+	}
+
+	fit.Default = "missing"
+	if config, reason := fit.Select(nil); config.Name != "conf-1" || reason != "first configuration" {
+		t.Errorf("no default: got %s (%s)", config.Name, reason)
+	}
+}
+
+func TestFITImage(t *testing.T) {
+	external := []byte("0123456789abcdef")
+	fit, err := ParseFIT(testFIT(t, external,
+		testImage("offset", nil, testProp{"data-offset", testUint32(4)}, testProp{"data-size", testUint32(6)}),
+		testImage("position", nil, testProp{"data-position", testUint32(0)}, testProp{"data-size", testUint32(4)}),
+		testImage("past-end", nil, testProp{"data-offset", testUint32(12)}, testProp{"data-size", testUint32(8)}),
+		testImage("wrapped-offset", nil, testProp{"data-offset", testUint32(0xfffffff0)}, testProp{"data-size", testUint32(4)}),
+		testImage("no-size", nil, testProp{"data-offset", testUint32(0)}),
+		testImage("no-offset", nil, testProp{"data-size", testUint32(4)}),
+		testImage("unknown-compression", []byte("data"), testProp{"compression", testStrings("lz5")}),
+		testImage("bad-sha256", []byte("data"), testProp{"compression", testStrings("none")}),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fit.imageNode("bad-sha256").Children = append(fit.imageNode("bad-sha256").Children, fit.imageNode("kernel-1").Children[0])
+
+	for name, want := range map[string]string{
+		"kernel-1":  "arm64 kernel",
+		"ramdisk-1": "ramdisk",
+		"offset":    "456789",
+		"position":  "\xd0\x0d\xfe\xed",
+	} {
+		if data, err := fit.Image(name); err != nil || string(data) != want {
+			t.Errorf("%s: got %q, %v, want %q", name, data, err, want)
+		}
+	}
+
+	for _, name := range []string{"missing", "past-end", "wrapped-offset", "no-size", "no-offset", "unknown-compression", "bad-sha256"} {
+		if _, err := fit.Image(name); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestVerifyHashes(t *testing.T) {
+	fit, err := ParseFIT(testFIT(t, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := fit.imageNode("kernel-1")
+	if err := verifyHashes(node, []byte("arm64 kernel")); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, algo := range []string{"sha256", "crc32", "md5"} {
+		hashes := node.Children
+		node.Children = hashes[i : i+1]
+		if err := verifyHashes(node, []byte("arm64 kernel!")); err == nil || !strings.Contains(err.Error(), algo) {
+			t.Errorf("%s: got %v", algo, err)
+		}
+
+		node.Children = hashes
+	}
+}
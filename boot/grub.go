@@ -0,0 +1,401 @@
+package boot
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var grubFiles = []string{
+	"boot/grub/grub.cfg",
+	"grub/grub.cfg",
+	"boot/grub2/grub.cfg",
+	"grub2/grub.cfg",
+	"EFI/*/grub.cfg",
+}
+
+var grubIgnored = map[string]bool{
+	"insmod": true, "load_video": true, "gfxmode": true, "echo": true, "terminal_input": true,
+	"terminal_output": true, "font": true, "loadfont": true, "recordfail": true, "savedefault": true,
+	"load_env": true, "save_env": true, "export": true, "play": true, "true": true, "clear": true,
+	"set_background_image": true, "background_image": true, "serial": true, "terminfo": true,
+}
+
+func ScanGrub(root string) (*Config, error) {
+	for _, pattern := range grubFiles {
+		files, _ := filepath.Glob(filepath.Join(root, pattern))
+		if len(files) > 0 {
+			name, _ := filepath.Rel(root, files[0])
+			return ParseGrubFile(root, name)
+		}
+	}
+
+	return &Config{}, nil
+}
+
+func ParseGrubFile(root string, name string) (*Config, error) {
+	interp := &grubInterp{
+		root:      root,
+		cfg:       &Config{},
+		vars:      readGrubEnv(root),
+		functions: map[string]bool{},
+	}
+
+	interp.vars["menuentry_id_option"] = "--id"
+	interp.vars["prefix"] = path.Dir("/" + filepath.ToSlash(name))
+
+	if err := interp.source(name); err != nil {
+		return nil, err
+	}
+
+	interp.resolveDefault()
+	return interp.cfg, nil
+}
+
+type grubInterp struct {
+	root      string
+	file      string
+	cfg       *Config
+	vars      map[string]string
+	functions map[string]bool
+	toplevel  []string
+	depth     int
+}
+
+func (g *grubInterp) warn(line int, format string, args ...any) {
+	log.Printf("grub: %s:%d: %s", g.file, line, fmt.Sprintf(format, args...))
+}
+
+func (g *grubInterp) source(name string) error {
+	if g.depth > 8 {
+		return fmt.Errorf("%s: configfile nesting is too deep", name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(g.root, name))
+	if err != nil {
+		return err
+	}
+
+	cmds, err := parseScript(string(data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	file := g.file
+	g.file = name
+	g.depth++
+	g.run(cmds, nil, "")
+	g.depth--
+	g.file = file
+
+	return nil
+}
+
+func (g *grubInterp) run(cmds []scriptCmd, entry *Entry, menu string) {
+	for _, cmd := range cmds {
+		g.exec(cmd, entry, menu)
+	}
+}
+
+func (g *grubInterp) exec(cmd scriptCmd, entry *Entry, menu string) {
+	if len(cmd.words) == 0 {
+		return
+	}
+
+	if key, value, ok := strings.Cut(cmd.words[0], "="); ok && len(cmd.words) == 1 && isGrubVar(key) {
+		g.vars[key] = g.expand(value)
+		return
+	}
+
+	name := g.expand(cmd.words[0])
+	args := []string{}
+	for _, word := range cmd.words[1:] {
+		args = append(args, g.expand(word))
+	}
+
+	switch name {
+	case "set":
+		if len(args) > 0 {
+			key, value, _ := strings.Cut(args[0], "=")
+			g.vars[key] = value
+		}
+	case "unset":
+		for _, key := range args {
+			delete(g.vars, key)
+		}
+	case "if":
+		for _, branch := range cmd.branches {
+			if branch.cond == nil || g.test(branch.cond, cmd.line) {
+				g.run(branch.body, entry, menu)
+				break
+			}
+		}
+	case "for", "while", "until":
+		g.warn(cmd.line, "%s loops are not supported, skipping", name)
+	case "function":
+		if len(args) > 0 {
+			g.functions[args[0]] = true
+		}
+	case "menuentry":
+		g.menuentry(cmd, args, menu, entry)
+	case "submenu":
+		title, _ := grubMenuArgs(args)
+		if menu == "" {
+			g.toplevel = append(g.toplevel, title)
+		}
+
+		g.run(cmd.body, nil, menu+title+" > ")
+	case "linux", "linux16", "linuxefi":
+		if g.inEntry(entry, cmd, name) && len(args) > 0 {
+			entry.Kernel = g.path(args[0])
+			entry.Cmdline = strings.Join(strings.Fields(strings.Join(args[1:], " ")), " ")
+			if root := g.vars["root"]; strings.Contains(root, "=") {
+				entry.Partition = root
+			}
+		}
+	case "initrd", "initrd16", "initrdefi":
+		if g.inEntry(entry, cmd, name) {
+			for _, arg := range args {
+				entry.Ramdisks = append(entry.Ramdisks, g.path(arg))
+			}
+		}
+	case "devicetree":
+		if g.inEntry(entry, cmd, name) && len(args) > 0 {
+			entry.Dtb = g.path(args[0])
+		}
+	case "search", "search.fs_uuid", "search.fs_label", "search.file":
+		g.search(cmd, name, args)
+	case "configfile", "source":
+		if len(args) > 0 {
+			if err := g.source(g.path(args[0])); err != nil {
+				g.warn(cmd.line, "%s %s: %s", name, args[0], err)
+			}
+		}
+	default:
+		if g.functions[name] {
+			g.warn(cmd.line, "calls to function %s are not supported, skipping", name)
+		} else if !grubIgnored[name] {
+			g.warn(cmd.line, "unsupported command %s", name)
+		}
+	}
+}
+
+func isGrubVar(name string) bool {
+	for i, c := range name {
+		if !isVersionLetter(c) && c != '_' && (i == 0 || !isVersionDigit(c)) {
+			return false
+		}
+	}
+
+	return name != ""
+}
+
+func (g *grubInterp) inEntry(entry *Entry, cmd scriptCmd, name string) bool {
+	if entry == nil {
+		g.warn(cmd.line, "%s outside of menuentry", name)
+	}
+
+	return entry != nil
+}
+
+func (g *grubInterp) menuentry(cmd scriptCmd, args []string, menu string, parent *Entry) {
+	if parent != nil {
+		g.warn(cmd.line, "nested menuentry is not supported")
+		return
+	}
+
+	title, id := grubMenuArgs(args)
+	entry := &Entry{Name: id, Title: menu + title}
+	if entry.Name == "" {
+		entry.Name = entry.Title
+	}
+
+	if menu == "" {
+		g.toplevel = append(g.toplevel, entry.Name)
+	}
+
+	vars := map[string]string{}
+	for key, value := range g.vars {
+		vars[key] = value
+	}
+
+	g.run(cmd.body, entry, menu)
+	g.vars = vars
+
+	if entry.Kernel == "" {
+		g.warn(cmd.line, "menuentry %s has no linux command, skipping", entry.Title)
+		return
+	}
+
+	g.cfg.Entries = append(g.cfg.Entries, *entry)
+}
+
+func grubMenuArgs(args []string) (title string, id string) {
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--id" && i+1 < len(args):
+			id = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--id="):
+			id = strings.TrimPrefix(arg, "--id=")
+		case arg == "--class" || arg == "--users" || arg == "--hotkey":
+			i++
+		case strings.HasPrefix(arg, "--"):
+		case title == "":
+			title = arg
+		}
+	}
+
+	return
+}
+
+func (g *grubInterp) search(cmd scriptCmd, name string, args []string) {
+	kind, variable, value := strings.TrimPrefix(name, "search."), "root", ""
+
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--fs-uuid" || arg == "-u":
+			kind = "fs_uuid"
+		case arg == "--label" || arg == "-l":
+			kind = "fs_label"
+		case arg == "--file" || arg == "-f":
+			kind = "file"
+		case arg == "--set" || arg == "-s":
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				variable = args[i+1]
+				i++
+			}
+		case strings.HasPrefix(arg, "--set="):
+			variable = strings.TrimPrefix(arg, "--set=")
+		case strings.HasPrefix(arg, "-"):
+		case value == "":
+			value = arg
+		case name != "search":
+			variable = arg
+		}
+	}
+
+	switch kind {
+	case "fs_uuid":
+		g.vars[variable] = "UUID=" + value
+	case "fs_label":
+		g.vars[variable] = "LABEL=" + value
+	case "file":
+		if _, err := os.Stat(filepath.Join(g.root, g.path(value))); err == nil {
+			g.vars[variable] = ""
+		} else {
+			g.warn(cmd.line, "search for file %s only looks at the boot partition", value)
+		}
+	default:
+		g.warn(cmd.line, "search needs one of --fs-uuid, --label or --file")
+	}
+}
+
+func (g *grubInterp) test(cond []string, line int) bool {
+	words := []string{}
+	for _, word := range cond {
+		words = append(words, g.expand(word))
+	}
+
+	if len(words) > 0 && words[0] == "[" && words[len(words)-1] == "]" {
+		words = words[1 : len(words)-1]
+	} else if len(words) > 0 && words[0] == "test" {
+		words = words[1:]
+	} else if len(words) > 0 && grubIgnored[words[0]] {
+		return false
+	} else {
+		g.warn(line, "condition '%s' is not supported, assuming false", strings.Join(words, " "))
+		return false
+	}
+
+	negate := len(words) > 0 && words[0] == "!"
+	if negate {
+		words = words[1:]
+	}
+
+	result := false
+	switch {
+	case len(words) == 3 && (words[1] == "=" || words[1] == "=="):
+		result = words[0] == words[2]
+	case len(words) == 3 && words[1] == "!=":
+		result = words[0] != words[2]
+	case len(words) == 2 && words[0] == "-n":
+		result = words[1] != ""
+	case len(words) == 2 && words[0] == "-z":
+		result = words[1] == ""
+	case len(words) == 2 && (words[0] == "-e" || words[0] == "-f" || words[0] == "-s"):
+		_, err := os.Stat(filepath.Join(g.root, g.path(words[1])))
+		result = err == nil
+	case len(words) == 1:
+		result = words[0] != ""
+	default:
+		g.warn(line, "test '%s' is not supported, assuming false", strings.Join(words, " "))
+		return false
+	}
+
+	return result != negate
+}
+
+func (g *grubInterp) expand(word string) string {
+	return expandVars(word, g.vars)
+}
+
+func (g *grubInterp) path(value string) string {
+	if strings.HasPrefix(value, "(") {
+		if end := strings.IndexByte(value, ')'); end >= 0 {
+			value = value[end+1:]
+		}
+	}
+
+	return bootPath(value)
+}
+
+func (g *grubInterp) resolveDefault() {
+	if timeout, err := strconv.Atoi(g.vars["timeout"]); err == nil {
+		g.cfg.Timeout = timeout
+	}
+
+	def := g.vars["default"]
+	if def == "" {
+		return
+	}
+
+	parts := strings.Split(def, ">")
+	if index, err := strconv.Atoi(parts[0]); err == nil && index >= 0 && index < len(g.toplevel) {
+		parts[0] = g.toplevel[index]
+	}
+
+	first, last := parts[0], parts[len(parts)-1]
+	if index, err := strconv.Atoi(last); err == nil && len(parts) > 1 {
+		for _, entry := range g.cfg.Entries {
+			if strings.HasPrefix(entry.Title, first+" > ") {
+				if index == 0 {
+					g.cfg.Default = entry.Name
+					return
+				}
+
+				index--
+			}
+		}
+	}
+
+	for _, match := range []func(Entry) bool{
+		func(e Entry) bool { return e.Name == last || e.Title == last || e.Title == strings.Join(parts, " > ") },
+		func(e Entry) bool {
+			return e.Name == first || e.Title == first || strings.HasPrefix(e.Title, first+" > ")
+		},
+	} {
+		for _, entry := range g.cfg.Entries {
+			if match(entry) {
+				g.cfg.Default = entry.Name
+				return
+			}
+		}
+	}
+
+	log.Printf("grub: default entry %s not found", def)
+}
@@ -0,0 +1,180 @@
+package boot
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testGrubMenu = `
+menuentry 'Fedora Linux (6.6.1)' --class fedora $menuentry_id_option 'fedora-6.6.1' {
+	linux /vmlinuz-6.6.1 root=UUID=1234 ro
+	initrd /initramfs-6.6.1.img
+}
+submenu 'Advanced options' $menuentry_id_option 'advanced' {
+	menuentry 'Fedora Linux (6.5.0)' --id fedora-6.5.0 {
+		linux /vmlinuz-6.5.0 root=UUID=1234 ro
+	}
+	menuentry 'Fedora Linux (6.5.0, recovery)' --id=fedora-6.5.0-recovery {
+		linux /vmlinuz-6.5.0 root=UUID=1234 ro single
+	}
+}
+menuentry 'UEFI Firmware Settings' {
+	fwsetup
+}
+`
+
+func parseTestGrub(t *testing.T, files map[string]string) *Config {
+	t.Helper()
+
+	cfg, err := ScanGrub(writeTestFiles(t, files))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cfg
+}
+
+func TestGrubEntries(t *testing.T) {
+	cfg := parseTestGrub(t, map[string]string{"boot/grub/grub.cfg": "set timeout=7\n" + testGrubMenu})
+
+	want := []Entry{
+		{Name: "fedora-6.6.1", Title: "Fedora Linux (6.6.1)", Kernel: "vmlinuz-6.6.1", Cmdline: "root=UUID=1234 ro", Ramdisks: []string{"initramfs-6.6.1.img"}},
+		{Name: "fedora-6.5.0", Title: "Advanced options > Fedora Linux (6.5.0)", Kernel: "vmlinuz-6.5.0", Cmdline: "root=UUID=1234 ro"},
+		{Name: "fedora-6.5.0-recovery", Title: "Advanced options > Fedora Linux (6.5.0, recovery)", Kernel: "vmlinuz-6.5.0", Cmdline: "root=UUID=1234 ro single"},
+	}
+
+	if !reflect.DeepEqual(cfg.Entries, want) {
+		t.Errorf("got %+v\nwant %+v", cfg.Entries, want)
+	}
+
+	if cfg.Timeout != 7 || cfg.Default != "" {
+		t.Errorf("timeout = %d, default = %q", cfg.Timeout, cfg.Default)
+	}
+}
+
+func TestGrubDefault(t *testing.T) {
+	tests := []struct {
+		def  string
+		want string
+	}{
+		{"0", "fedora-6.6.1"},
+		{"fedora-6.6.1", "fedora-6.6.1"},
+		{"'Fedora Linux (6.6.1)'", "fedora-6.6.1"},
+		{"1", "fedora-6.5.0"},
+		{"1>1", "fedora-6.5.0-recovery"},
+		{"'Advanced options>1'", "fedora-6.5.0-recovery"},
+		{"'Advanced options>Fedora Linux (6.5.0, recovery)'", "fedora-6.5.0-recovery"},
+		{"advanced>fedora-6.5.0-recovery", "fedora-6.5.0-recovery"},
+		{"missing", ""},
+		{"2", ""},
+	}
+
+	for _, test := range tests {
+		cfg := parseTestGrub(t, map[string]string{"boot/grub/grub.cfg": "set default=" + test.def + "\n" + testGrubMenu})
+		if cfg.Default != test.want {
+			t.Errorf("default=%s: got %q, want %q", test.def, cfg.Default, test.want)
+		}
+	}
+
+	cfg := parseTestGrub(t, map[string]string{
+		"boot/grub/grub.cfg": testGrubMenu,
+		"grub2/grubenv":      "# GRUB Environment Block\nsaved_entry=fedora-6.5.0\n",
+	})
+
+	if cfg.Default != "" {
+		t.Errorf("grubenv without default: got %q", cfg.Default)
+	}
+
+	cfg = parseTestGrub(t, map[string]string{
+		"boot/grub/grub.cfg": "load_env\nif [ -n \"${saved_entry}\" ]; then\n set default=\"${saved_entry}\"\nfi\n" + testGrubMenu,
+		"grub/grubenv":       "saved_entry=fedora-6.5.0\n",
+	})
+
+	if cfg.Default != "fedora-6.5.0" {
+		t.Errorf("saved_entry: got %q", cfg.Default)
+	}
+}
+
+func TestGrubSearch(t *testing.T) {
+	cfg := parseTestGrub(t, map[string]string{
+		"boot/grub/grub.cfg": `
+search --no-floppy --fs-uuid --set=root 3f99f65c-4c1d-4994-917c-ebcee66c9a92
+menuentry 'uuid' {
+	linux /vmlinuz
+}
+menuentry 'label' {
+	search -s -l BOOT
+	linux /vmlinuz
+}
+menuentry 'file' {
+	search.file /vmlinuz
+	linux /vmlinuz
+}
+menuentry 'other variable' {
+	search.fs_uuid 1234 bootdev
+	linux ($bootdev)/vmlinuz
+}
+menuentry 'missing file' {
+	search --file --set /vmlinuz-missing
+	linux /vmlinuz
+}
+`,
+		"vmlinuz": "kernel",
+	})
+
+	want := map[string]string{
+		"uuid":           "UUID=3f99f65c-4c1d-4994-917c-ebcee66c9a92",
+		"label":          "LABEL=BOOT",
+		"file":           "",
+		"other variable": "UUID=3f99f65c-4c1d-4994-917c-ebcee66c9a92",
+		"missing file":   "UUID=3f99f65c-4c1d-4994-917c-ebcee66c9a92",
+	}
+
+	if len(cfg.Entries) != len(want) {
+		t.Fatalf("got %d entries", len(cfg.Entries))
+	}
+
+	for _, entry := range cfg.Entries {
+		if entry.Partition != want[entry.Name] || entry.Kernel != "vmlinuz" {
+			t.Errorf("%s: partition = %q, kernel = %q, want %q", entry.Name, entry.Partition, entry.Kernel, want[entry.Name])
+		}
+	}
+}
+
+func TestGrubConfigfile(t *testing.T) {
+	cfg := parseTestGrub(t, map[string]string{
+		"EFI/debian/grub.cfg":  "search.fs_uuid 1234 root\nset prefix=($root)'/boot/grub'\nconfigfile $prefix/grub.cfg\n",
+		"boot/grub/grub.cfg":   "set timeout=3\nsource ${prefix}/custom.cfg\nconfigfile /boot/grub/missing.cfg\n" + testGrubMenu,
+		"boot/grub/custom.cfg": "menuentry 'custom' {\n\tlinux /boot/vmlinuz-custom\n}\n",
+		"boot/grub/loop.cfg":   "configfile /boot/grub/loop.cfg\n",
+	})
+
+	if len(cfg.Entries) != 4 || cfg.Entries[0].Name != "custom" || cfg.Entries[0].Kernel != "boot/vmlinuz-custom" || cfg.Timeout != 3 {
+		t.Errorf("got %+v", cfg)
+	}
+
+	if _, err := ParseGrubFile(writeTestFiles(t, map[string]string{"boot/grub/grub.cfg": "configfile /boot/grub/grub.cfg\n"}), "boot/grub/grub.cfg"); err != nil {
+		t.Errorf("recursive configfile: %v", err)
+	}
+}
+
+func TestGrubAssignment(t *testing.T) {
+	cfg := parseTestGrub(t, map[string]string{"boot/grub/grub.cfg": `
+timeout=-1
+kernel=/vmlinuz-6.6.1
+id=fedora-6.6.1
+default="${id}"
+1abc=ignored
+function load_kernel {
+	linux $kernel
+}
+menuentry 'Fedora Linux (6.6.1)' --id fedora-6.6.1 {
+	load_kernel
+	linux $kernel quiet
+}
+`})
+
+	if cfg.Timeout != -1 || len(cfg.Entries) != 1 || cfg.Entries[0].Kernel != "vmlinuz-6.6.1" || cfg.Default != "fedora-6.6.1" {
+		t.Errorf("got %+v", cfg)
+	}
+}
@@ -0,0 +1,204 @@
+package boot
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+var ErrUnknownKernel = errors.New("unknown kernel image format")
+
+var (
+	unameArchitectures = map[string]string{
+		"aarch64": "arm64", "aarch64_be": "arm64",
+		"x86_64": "amd64", "i386": "386", "i486": "386", "i586": "386", "i686": "386",
+		"riscv64": "riscv64", "loongarch64": "loong64",
+		"ppc64": "ppc64", "ppc64le": "ppc64le", "s390x": "s390x",
+	}
+	peArchitectures = map[uint16]string{
+		0x014c: "386", 0x8664: "amd64", 0x01c2: "arm", 0xaa64: "arm64", 0x5064: "riscv64", 0x6264: "loong64",
+	}
+	elfArchitectures = map[uint16]string{
+		0x03: "386", 0x3e: "amd64", 0x28: "arm", 0xb7: "arm64", 0xf3: "riscv64", 0x102: "loong64", 0x15: "ppc64", 0x16: "s390x",
+	}
+)
+
+type KernelImage struct {
+	Format      string
+	Arch        string
+	Compression string
+	Size        int
+}
+
+func (k KernelImage) String() string {
+	s := k.Arch + " " + k.Format
+	if k.Compression != "" {
+		s = k.Compression + "-compressed " + s
+	}
+
+	return s
+}
+
+func (k KernelImage) Raw() bool {
+	return k.Compression == "" && k.Format != "EFI zboot"
+}
+
+func MachineArch() string {
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err != nil {
+		return ""
+	}
+
+	machine := unix.ByteSliceToString(uname.Machine[:])
+	if arch, ok := unameArchitectures[machine]; ok {
+		return arch
+	}
+
+	if strings.HasPrefix(machine, "arm") {
+		return "arm"
+	}
+
+	return machine
+}
+
+func DetectKernel(data []byte) KernelImage {
+	le := binary.LittleEndian
+	image := KernelImage{Size: len(data)}
+
+	switch {
+	case len(data) >= 64 && string(data[56:60]) == "ARMd":
+		image.Format, image.Arch = "Image", "arm64"
+	case len(data) >= 64 && string(data[56:60]) == "RSC\x05":
+		image.Format, image.Arch = "Image", "riscv64"
+	case len(data) >= 0x238 && string(data[0x202:0x206]) == "HdrS" && le.Uint16(data[0x1fe:]) == 0xaa55:
+		image.Format, image.Arch = "bzImage", "386"
+		if le.Uint16(data[0x206:]) >= 0x20c && data[0x236]&1 != 0 {
+			image.Arch = "amd64"
+		}
+	case len(data) >= 64 && string(data[:2]) == "MZ" && string(data[4:8]) == "zimg":
+		image.Format, image.Arch = "EFI zboot", peArch(data)
+		image.Compression = strings.TrimRight(string(data[24:32]), "\x00")
+	case len(data) >= 0x30 && le.Uint32(data[0x24:]) == 0x016f2818:
+		image.Format, image.Arch = "zImage", "arm"
+	case len(data) >= 64 && string(data[:2]) == "MZ" && peArch(data) != "":
+		image.Format, image.Arch = "EFI", peArch(data)
+	case len(data) >= 20 && string(data[:4]) == "\x7fELF":
+		machine := le.Uint16(data[18:])
+		if data[5] == 2 {
+			machine = binary.BigEndian.Uint16(data[18:])
+		}
+
+		image.Format, image.Arch = "vmlinux", elfArchitectures[machine]
+	default:
+		image.Compression = Compression(data)
+	}
+
+	return image
+}
+
+func peArch(data []byte) string {
+	off := int(binary.LittleEndian.Uint32(data[0x3c:]))
+	if off < 0 || off+6 > len(data) || string(data[off:off+4]) != "PE\x00\x00" {
+		return ""
+	}
+
+	return peArchitectures[binary.LittleEndian.Uint16(data[off+4:])]
+}
+
+func decompressKernel(compression string, data []byte) ([]byte, error) {
+	raw, err := Decompress(compression, data)
+	if err == nil || len(data) <= 4 {
+		return raw, err
+	}
+
+	sizeTrailer := int(binary.LittleEndian.Uint32(data[len(data)-4:]))
+	if trimmed, terr := Decompress(compression, data[:len(data)-4]); terr == nil && len(trimmed) == sizeTrailer {
+		return trimmed, nil
+	}
+
+	return nil, err
+}
+
+func UnpackKernel(data []byte) ([]byte, KernelImage, error) {
+	image := DetectKernel(data)
+
+	if image.Format == "EFI zboot" {
+		le := binary.LittleEndian
+		off, size := uint64(le.Uint32(data[8:])), uint64(le.Uint32(data[12:]))
+		if off+size > uint64(len(data)) {
+			return nil, image, fmt.Errorf("EFI zboot payload is out of bounds")
+		}
+
+		payload := data[off : off+size]
+		raw, err := decompressKernel(Compression(payload), payload)
+		if err != nil {
+			return nil, image, fmt.Errorf("EFI zboot payload: %w", err)
+		}
+
+		inner := DetectKernel(raw)
+		if inner.Format == "" || !inner.Raw() {
+			return nil, image, fmt.Errorf("EFI zboot payload: %w", ErrUnknownKernel)
+		}
+
+		inner.Compression = Compression(payload)
+		inner.Format = image.Format + " " + inner.Format
+		return raw, inner, nil
+	}
+
+	if image.Format != "" {
+		return data, image, nil
+	}
+
+	if image.Compression == "" {
+		return nil, image, ErrUnknownKernel
+	}
+
+	raw, err := decompressKernel(image.Compression, data)
+	if err != nil {
+		return nil, image, err
+	}
+
+	inner := DetectKernel(raw)
+	if inner.Format == "" || !inner.Raw() {
+		return nil, image, fmt.Errorf("%s payload: %w", image.Compression, ErrUnknownKernel)
+	}
+
+	inner.Compression = image.Compression
+	return raw, inner, nil
+}
+
+func PrepareKernel(path string, dir string) (string, KernelImage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", KernelImage{}, err
+	}
+
+	raw, image, err := UnpackKernel(data)
+	if err != nil {
+		return "", image, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if arch := MachineArch(); arch != "" && image.Arch != arch {
+		return "", image, fmt.Errorf("%s: %s can't run on this %s machine", path, image, arch)
+	}
+
+	if image.Raw() {
+		return path, image, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", image, err
+	}
+
+	out := filepath.Join(dir, "Image")
+	if err := os.WriteFile(out, raw, 0o644); err != nil {
+		return "", image, fmt.Errorf("%s: %w", out, err)
+	}
+
+	return out, image, nil
+}
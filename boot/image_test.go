@@ -0,0 +1,154 @@
+package boot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func testKernel(size int, set func([]byte)) []byte {
+	data := make([]byte, size)
+	set(data)
+	return data
+}
+
+func testArm64Image() []byte {
+	return testKernel(4096, func(data []byte) {
+		copy(data[56:], "ARMd")
+		copy(data[64:], "arm64 kernel body")
+	})
+}
+
+func testPE(machine uint16, set func([]byte)) []byte {
+	return testKernel(512, func(data []byte) {
+		copy(data, "MZ")
+		binary.LittleEndian.PutUint32(data[0x3c:], 0x80)
+		copy(data[0x80:], "PE\x00\x00")
+		binary.LittleEndian.PutUint16(data[0x84:], machine)
+		if set != nil {
+			set(data)
+		}
+	})
+}
+
+func TestDetectKernel(t *testing.T) {
+	le := binary.LittleEndian
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"arm64 Image", testArm64Image(), "arm64 Image"},
+		{"riscv64 Image", testKernel(64, func(data []byte) { copy(data[56:], "RSC\x05") }), "riscv64 Image"},
+		{"bzImage", testKernel(0x238, func(data []byte) {
+			le.PutUint16(data[0x1fe:], 0xaa55)
+			copy(data[0x202:], "HdrS")
+			le.PutUint16(data[0x206:], 0x20f)
+			data[0x236] = 1
+		}), "amd64 bzImage"},
+		{"32-bit bzImage", testKernel(0x238, func(data []byte) {
+			le.PutUint16(data[0x1fe:], 0xaa55)
+			copy(data[0x202:], "HdrS")
+			le.PutUint16(data[0x206:], 0x20f)
+		}), "386 bzImage"},
+		{"zImage", testKernel(0x30, func(data []byte) { le.PutUint32(data[0x24:], 0x016f2818) }), "arm zImage"},
+		{"EFI zboot", testPE(0xaa64, func(data []byte) {
+			copy(data[4:], "zimg")
+			copy(data[24:], "zstd")
+		}), "zstd-compressed arm64 EFI zboot"},
+		{"EFI", testPE(0x5064, nil), "riscv64 EFI"},
+		{"vmlinux", testKernel(64, func(data []byte) {
+			copy(data, "\x7fELF")
+			data[5] = 1
+			le.PutUint16(data[18:], 0xb7)
+		}), "arm64 vmlinux"},
+		{"big endian vmlinux", testKernel(64, func(data []byte) {
+			copy(data, "\x7fELF")
+			data[5] = 2
+			binary.BigEndian.PutUint16(data[18:], 0x16)
+		}), "s390x vmlinux"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := DetectKernel(test.data).String(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	for _, data := range [][]byte{nil, []byte("MZ"), make([]byte, 4096), testPE(0x1234, nil)} {
+		if image := DetectKernel(data); image.Format != "" || image.Compression != "" {
+			t.Errorf("%d bytes: detected %s", len(data), image)
+		}
+	}
+}
+
+func TestUnpackKernel(t *testing.T) {
+	raw := testArm64Image()
+	gzipped := compress(t, "gzip", raw)
+	trailer := binary.LittleEndian.AppendUint32(compress(t, "xz", raw), uint32(len(raw)))
+
+	payload := compress(t, "gzip", raw)
+	zboot := testPE(0xaa64, func(data []byte) {
+		copy(data[4:], "zimg")
+		copy(data[24:], "gzip")
+		binary.LittleEndian.PutUint32(data[8:], 512)
+		binary.LittleEndian.PutUint32(data[12:], uint32(len(payload)))
+	})
+	zboot = append(zboot, payload...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"raw", raw, "arm64 Image"},
+		{"gzip", gzipped, "gzip-compressed arm64 Image"},
+		{"xz with size trailer", trailer, "xz-compressed arm64 Image"},
+		{"EFI zboot", zboot, "gzip-compressed arm64 EFI zboot Image"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, image, err := UnpackKernel(test.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if image.String() != test.want {
+				t.Errorf("image = %q, want %q", image, test.want)
+			}
+
+			if !bytes.Equal(out, raw) {
+				t.Errorf("got %d bytes, want the raw Image", len(out))
+			}
+		})
+	}
+}
+
+func TestUnpackKernelErrors(t *testing.T) {
+	zboot := testPE(0xaa64, func(data []byte) {
+		copy(data[4:], "zimg")
+		copy(data[24:], "gzip")
+		binary.LittleEndian.PutUint32(data[8:], 0xfffffff0)
+		binary.LittleEndian.PutUint32(data[12:], 0x100)
+	})
+
+	if _, _, err := UnpackKernel(make([]byte, 4096)); !errors.Is(err, ErrUnknownKernel) {
+		t.Errorf("unknown image: got %v", err)
+	}
+
+	if _, _, err := UnpackKernel(compress(t, "gzip", []byte("not a kernel"))); !errors.Is(err, ErrUnknownKernel) {
+		t.Errorf("compressed garbage: got %v", err)
+	}
+
+	if _, _, err := UnpackKernel(zboot); err == nil {
+		t.Error("zboot payload out of bounds: expected an error")
+	}
+
+	if _, _, err := UnpackKernel(mustHex(testXzArm64)); err == nil {
+		t.Error("BCJ filtered xz: expected an error")
+	}
+}
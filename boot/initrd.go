@@ -0,0 +1,188 @@
+package boot
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type InitrdFile struct {
+	Target string
+	Source string
+}
+
+type CpioFile struct {
+	Name string
+	Mode fs.FileMode
+	Data []byte
+}
+
+type CpioWriter struct {
+	w    io.Writer
+	ino  uint32
+	dirs map[string]bool
+	err  error
+}
+
+func NewCpioWriter(w io.Writer) *CpioWriter {
+	return &CpioWriter{w: w, ino: 1, dirs: map[string]bool{".": true, "/": true}}
+}
+
+func (c *CpioWriter) header(name string, mode uint32, size int) {
+	if c.err != nil {
+		return
+	}
+
+	nlink := 1
+	if mode&0o170000 == 0o040000 {
+		nlink = 2
+	}
+
+	_, c.err = fmt.Fprintf(c.w, "070701%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%s\x00",
+		c.ino, mode, 0, 0, nlink, 0, size, 0, 0, 0, 0, len(name)+1, 0, name)
+	c.ino++
+	c.pad(110 + len(name) + 1)
+}
+
+func (c *CpioWriter) pad(n int) {
+	if c.err == nil && n%4 != 0 {
+		_, c.err = c.w.Write(make([]byte, 4-n%4))
+	}
+}
+
+func (c *CpioWriter) mkdirAll(dir string) {
+	if c.dirs[dir] {
+		return
+	}
+
+	c.mkdirAll(path.Dir(dir))
+	c.dirs[dir] = true
+	c.header(dir, 0o040755, 0)
+}
+
+func (c *CpioWriter) Add(file CpioFile) error {
+	name := strings.TrimPrefix(path.Clean("/"+file.Name), "/")
+	if name == "" {
+		return fmt.Errorf("cpio: empty file name")
+	}
+
+	c.mkdirAll(path.Dir(name))
+	if file.Mode.IsDir() {
+		c.mkdirAll(name)
+		return c.err
+	}
+
+	mode := uint32(file.Mode.Perm()) | 0o100000
+	if file.Mode.Perm() == 0 {
+		mode |= 0o644
+	}
+
+	c.header(name, mode, len(file.Data))
+	if c.err == nil {
+		_, c.err = c.w.Write(file.Data)
+	}
+
+	c.pad(len(file.Data))
+	return c.err
+}
+
+func (c *CpioWriter) Close() error {
+	c.header("TRAILER!!!", 0, 0)
+	return c.err
+}
+
+func ReadInitrdFiles(target string, source string) ([]CpioFile, error) {
+	files := []CpioFile{}
+	err := filepath.WalkDir(source, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(source, file)
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		name := path.Join(target, filepath.ToSlash(rel))
+		if d.IsDir() {
+			files = append(files, CpioFile{Name: name, Mode: info.Mode()})
+			return nil
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, CpioFile{Name: name, Mode: info.Mode(), Data: data})
+		return nil
+	})
+
+	return files, err
+}
+
+func ComposeInitrd(out string, ramdisks []string, files []CpioFile) error {
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	size := 0
+	for _, ramdisk := range ramdisks {
+		src, err := os.Open(ramdisk)
+		if err != nil {
+			return err
+		}
+
+		n, err := io.Copy(w, src)
+		src.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", ramdisk, err)
+		}
+
+		size += int(n)
+		if size%4 != 0 {
+			w.Write(make([]byte, 4-size%4))
+			size += 4 - size%4
+		}
+	}
+
+	if len(files) > 0 {
+		cpio := NewCpioWriter(w)
+		for _, file := range files {
+			if err := cpio.Add(file); err != nil {
+				return fmt.Errorf("%s: %w", file.Name, err)
+			}
+		}
+
+		if err := cpio.Close(); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("%s: %w", out, err)
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,177 @@
+package boot
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+type cpioEntry struct {
+	name string
+	mode uint32
+	data string
+}
+
+func readCpio(t *testing.T, data []byte) []cpioEntry {
+	t.Helper()
+
+	entries := []cpioEntry{}
+	inodes := map[uint64]bool{}
+	for off := 0; ; {
+		if off%4 != 0 {
+			t.Fatalf("header at %d is not aligned", off)
+		}
+
+		if off+110 > len(data) || string(data[off:off+6]) != "070701" {
+			t.Fatalf("bad header at %d", off)
+		}
+
+		field := func(i int) uint64 {
+			v, err := strconv.ParseUint(string(data[off+6+i*8:off+14+i*8]), 16, 32)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return v
+		}
+
+		ino, mode, size, namesize := field(0), uint32(field(1)), int(field(6)), int(field(11))
+		if namesize == 0 || off+110+namesize+size > len(data) {
+			t.Fatalf("entry at %d is truncated", off)
+		}
+
+		name := string(data[off+110 : off+110+namesize])
+		if name[len(name)-1] != 0 {
+			t.Fatalf("name %q is not terminated", name)
+		}
+
+		name = name[:len(name)-1]
+		off = (off + 110 + namesize + 3) &^ 3
+		if name == "TRAILER!!!" {
+			if off != len(data) {
+				t.Errorf("%d bytes after the trailer", len(data)-off)
+			}
+
+			return entries
+		}
+
+		if inodes[ino] {
+			t.Errorf("%s: inode %d is reused", name, ino)
+		}
+
+		inodes[ino] = true
+		entries = append(entries, cpioEntry{name, mode, string(data[off : off+size])})
+		off = (off + size + 3) &^ 3
+	}
+}
+
+func TestCpioWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCpioWriter(&buf)
+	for _, file := range []CpioFile{
+		{Name: "/etc/sideboot/boot.json", Mode: 0o644, Data: []byte("{}\n")},
+		{Name: "etc/sideboot/key", Mode: 0o600, Data: []byte("12345")},
+		{Name: "lib/firmware", Mode: os.ModeDir | 0o755},
+		{Name: "lib/firmware/a.bin", Data: []byte("abcd")},
+		{Name: "../../escape", Mode: 0o755, Data: []byte("x")},
+	} {
+		if err := w.Add(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Add(CpioFile{Name: "/"}); err == nil {
+		t.Error("empty name: expected an error")
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []cpioEntry{
+		{"etc", 0o040755, ""},
+		{"etc/sideboot", 0o040755, ""},
+		{"etc/sideboot/boot.json", 0o100644, "{}\n"},
+		{"etc/sideboot/key", 0o100600, "12345"},
+		{"lib", 0o040755, ""},
+		{"lib/firmware", 0o040755, ""},
+		{"lib/firmware/a.bin", 0o100644, "abcd"},
+		{"escape", 0o100755, "x"},
+	}
+
+	if got := readCpio(t, buf.Bytes()); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestComposeInitrd(t *testing.T) {
+	dir := t.TempDir()
+	ramdisks := []string{filepath.Join(dir, "a.img"), filepath.Join(dir, "b.img")}
+	os.WriteFile(ramdisks[0], []byte("first"), 0o644)
+	os.WriteFile(ramdisks[1], []byte("second!!"), 0o644)
+
+	out := filepath.Join(dir, "out", "initrd.img")
+	if err := ComposeInitrd(out, ramdisks, []CpioFile{{Name: "init.conf", Data: []byte("x=1")}}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "first\x00\x00\x00second!!"; string(data[:16]) != want {
+		t.Errorf("ramdisks = %q, want %q", data[:16], want)
+	}
+
+	if got := readCpio(t, data[16:]); !reflect.DeepEqual(got, []cpioEntry{{"init.conf", 0o100644, "x=1"}}) {
+		t.Errorf("cpio = %+v", got)
+	}
+
+	if err := ComposeInitrd(out, []string{filepath.Join(dir, "missing.img")}, nil); err == nil {
+		t.Error("missing ramdisk: expected an error")
+	}
+}
+
+func TestReadInitrdFiles(t *testing.T) {
+	source := t.TempDir()
+	os.MkdirAll(filepath.Join(source, "qcom/sc7180"), 0o755)
+	os.WriteFile(filepath.Join(source, "qcom/sc7180/a630_zap.mbn"), []byte("zap"), 0o644)
+	os.WriteFile(filepath.Join(source, "regulatory.db"), []byte("db"), 0o600)
+	os.Symlink("regulatory.db", filepath.Join(source, "link.db"))
+	for _, dir := range []string{"", "qcom", "qcom/sc7180"} {
+		os.Chmod(filepath.Join(source, dir), 0o755)
+	}
+
+	os.Chmod(filepath.Join(source, "qcom/sc7180/a630_zap.mbn"), 0o644)
+	os.Chmod(filepath.Join(source, "regulatory.db"), 0o600)
+
+	files, err := ReadInitrdFiles("/lib/firmware", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	for _, file := range files {
+		got[file.Name] = file.Mode.String() + " " + string(file.Data)
+	}
+
+	want := map[string]string{
+		"/lib/firmware":                          "drwxr-xr-x ",
+		"/lib/firmware/qcom":                     "drwxr-xr-x ",
+		"/lib/firmware/qcom/sc7180":              "drwxr-xr-x ",
+		"/lib/firmware/qcom/sc7180/a630_zap.mbn": "-rw-r--r-- zap",
+		"/lib/firmware/regulatory.db":            "-rw------- db",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+
+	if _, err := ReadInitrdFiles("/lib/firmware", filepath.Join(source, "missing")); err == nil {
+		t.Error("missing source: expected an error")
+	}
+}
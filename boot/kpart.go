@@ -0,0 +1,212 @@
+package boot
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sideboot/fdt"
+)
+
+const (
+	keyblockMagic    = "CHROMEOS"
+	crosConfigSize   = 4096
+	crosParamsSize   = 4096
+	keyblockSize     = 112
+	kernelPreambleV2 = 104
+)
+
+type KernelPartition struct {
+	Version     uint64
+	LoadAddress uint64
+	Kernel      []byte
+	Cmdline     string
+	Bootloader  []byte
+}
+
+func IsKernelPartition(path string) bool {
+	return readMagic(path, len(keyblockMagic)) == keyblockMagic
+}
+
+type kernelLayout struct {
+	version        uint64
+	loadAddress    uint64
+	bodyOff        int64
+	configOff      int64
+	bootloaderOff  int64
+	bootloaderSize uint64
+}
+
+func ReadKernelPartition(path string) (*KernelPartition, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	layout, err := readKernelLayout(f, size)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	kpart := &KernelPartition{
+		Version:     layout.version,
+		LoadAddress: layout.loadAddress,
+		Kernel:      make([]byte, layout.configOff-layout.bodyOff),
+		Bootloader:  make([]byte, layout.bootloaderSize),
+	}
+
+	if _, err := f.ReadAt(kpart.Kernel, layout.bodyOff); err != nil {
+		return nil, fmt.Errorf("%s: kernel body: %w", path, err)
+	}
+
+	if _, err := f.ReadAt(kpart.Bootloader, layout.bootloaderOff); err != nil {
+		return nil, fmt.Errorf("%s: bootloader: %w", path, err)
+	}
+
+	if kpart.Cmdline, err = readKernelConfig(f, layout); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return kpart, nil
+}
+
+func ReadKernelCmdline(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", err
+	}
+
+	layout, err := readKernelLayout(f, size)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+
+	cmdline, err := readKernelConfig(f, layout)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+
+	return cmdline, nil
+}
+
+func readKernelConfig(r io.ReaderAt, layout kernelLayout) (string, error) {
+	config := make([]byte, crosConfigSize)
+	if _, err := r.ReadAt(config, layout.configOff); err != nil {
+		return "", fmt.Errorf("kernel config: %w", err)
+	}
+
+	return strings.TrimSpace(cstring(config)), nil
+}
+
+func readKernelLayout(r io.ReaderAt, size int64) (kernelLayout, error) {
+	le := binary.LittleEndian
+	layout := kernelLayout{}
+
+	keyblock := make([]byte, keyblockSize)
+	if _, err := r.ReadAt(keyblock, 0); err != nil {
+		return layout, fmt.Errorf("keyblock: %w", err)
+	}
+
+	if string(keyblock[:8]) != keyblockMagic {
+		return layout, fmt.Errorf("no vboot keyblock")
+	}
+
+	if major := le.Uint32(keyblock[8:]); major != 2 {
+		return layout, fmt.Errorf("keyblock version %d is not supported", major)
+	}
+
+	preambleOff := le.Uint64(keyblock[16:])
+	if preambleOff > uint64(size) || kernelPreambleV2 > uint64(size)-preambleOff {
+		return layout, fmt.Errorf("kernel preamble at %#x is outside the partition", preambleOff)
+	}
+
+	preamble := make([]byte, kernelPreambleV2)
+	if _, err := r.ReadAt(preamble, int64(preambleOff)); err != nil {
+		return layout, fmt.Errorf("kernel preamble: %w", err)
+	}
+
+	if major := le.Uint32(preamble[32:]); major != 2 {
+		return layout, fmt.Errorf("kernel preamble version %d is not supported", major)
+	}
+
+	layout.version = le.Uint64(preamble[40:])
+	layout.loadAddress = le.Uint64(preamble[48:])
+	layout.bootloaderSize = le.Uint64(preamble[64:])
+
+	bodyOff, bodySize := preambleOff+le.Uint64(preamble[0:]), le.Uint64(preamble[88:])
+	if bodyOff < preambleOff || bodyOff > uint64(size) || bodySize > uint64(size)-bodyOff {
+		return layout, fmt.Errorf("kernel body of %d bytes at %#x is outside the partition", bodySize, bodyOff)
+	}
+
+	bootloaderAddr := le.Uint64(preamble[56:])
+	if bootloaderAddr < layout.loadAddress || bootloaderAddr-layout.loadAddress < crosConfigSize+crosParamsSize {
+		return layout, fmt.Errorf("bootloader address %#x is below the kernel body", bootloaderAddr)
+	}
+
+	bootloader := bootloaderAddr - layout.loadAddress
+	if bootloader > bodySize || layout.bootloaderSize > bodySize-bootloader {
+		return layout, fmt.Errorf("kernel body of %d bytes is too small for its layout", bodySize)
+	}
+
+	layout.bodyOff = int64(bodyOff)
+	layout.configOff = layout.bodyOff + int64(bootloader-crosConfigSize-crosParamsSize)
+	layout.bootloaderOff = layout.bodyOff + int64(bootloader)
+	return layout, nil
+}
+
+func ExpandKernelCmdline(cmdline string, partuuid string) string {
+	return strings.ReplaceAll(cmdline, "%U", partuuid)
+}
+
+func ExtractKernelPartition(entry Entry, dir string, partuuid string, machine []string) (Entry, error) {
+	source := entry.Kernel
+	kpart, err := ReadKernelPartition(source)
+	if err != nil {
+		return entry, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return entry, err
+	}
+
+	entry.Kernel = filepath.Join(dir, "body")
+	if err := os.WriteFile(entry.Kernel, kpart.Kernel, 0o644); err != nil {
+		return entry, err
+	}
+
+	if len(kpart.Bootloader) > 0 {
+		if err := os.WriteFile(filepath.Join(dir, "bootloader"), kpart.Bootloader, 0o644); err != nil {
+			return entry, err
+		}
+	}
+
+	if strings.Contains(kpart.Cmdline, "%U") && partuuid == "" {
+		log.Printf("kpart: %s: cmdline uses %%U but the partition uuid is unknown", source)
+	}
+
+	if entry.Cmdline == "" {
+		entry.Cmdline = ExpandKernelCmdline(kpart.Cmdline, partuuid)
+	}
+
+	if fdt.IsFDT(kpart.Kernel) {
+		return ExtractFIT(entry, dir, machine)
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,134 @@
+package boot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testLoadAddress = 0x100000
+
+func testKernelPartition(t *testing.T, set func(keyblock, preamble []byte)) string {
+	t.Helper()
+
+	le := binary.LittleEndian
+	keyblock, preamble := make([]byte, 0x100), make([]byte, 0x100)
+	copy(keyblock, keyblockMagic)
+	le.PutUint32(keyblock[8:], 2)
+	le.PutUint64(keyblock[16:], uint64(len(keyblock)))
+
+	body := make([]byte, 0x3010)
+	copy(body, "kernel image")
+	copy(body[0x1000:], "console=tty1 root=PARTUUID=%U/PARTNROFF=1\n")
+	copy(body[0x3000:], "bootloader stub!")
+
+	le.PutUint64(preamble[0:], uint64(len(preamble)))
+	le.PutUint32(preamble[32:], 2)
+	le.PutUint64(preamble[40:], 3)
+	le.PutUint64(preamble[48:], testLoadAddress)
+	le.PutUint64(preamble[56:], testLoadAddress+0x3000)
+	le.PutUint64(preamble[64:], 0x10)
+	le.PutUint64(preamble[88:], uint64(len(body)))
+
+	if set != nil {
+		set(keyblock, preamble)
+	}
+
+	path := filepath.Join(t.TempDir(), "kpart")
+	if err := os.WriteFile(path, bytes.Join([][]byte{keyblock, preamble, body}, nil), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestReadKernelPartition(t *testing.T) {
+	path := testKernelPartition(t, nil)
+	if !IsKernelPartition(path) {
+		t.Error("IsKernelPartition = false")
+	}
+
+	kpart, err := ReadKernelPartition(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kpart.Version != 3 || kpart.LoadAddress != testLoadAddress {
+		t.Errorf("version = %d, load address = %#x", kpart.Version, kpart.LoadAddress)
+	}
+
+	if len(kpart.Kernel) != 0x1000 || !bytes.HasPrefix(kpart.Kernel, []byte("kernel image\x00")) {
+		t.Errorf("kernel = %q...", kpart.Kernel[:16])
+	}
+
+	if string(kpart.Bootloader) != "bootloader stub!" {
+		t.Errorf("bootloader = %q", kpart.Bootloader)
+	}
+
+	if want := "console=tty1 root=PARTUUID=%U/PARTNROFF=1"; kpart.Cmdline != want {
+		t.Errorf("cmdline = %q, want %q", kpart.Cmdline, want)
+	}
+
+	if cmdline, err := ReadKernelCmdline(path); err != nil || cmdline != kpart.Cmdline {
+		t.Errorf("ReadKernelCmdline = %q, %v", cmdline, err)
+	}
+}
+
+func TestReadKernelPartitionErrors(t *testing.T) {
+	le := binary.LittleEndian
+	tests := []struct {
+		name string
+		set  func(keyblock, preamble []byte)
+		err  string
+	}{
+		{"magic", func(k, p []byte) { copy(k, "CHROMEOX") }, "no vboot keyblock"},
+		{"keyblock version", func(k, p []byte) { le.PutUint32(k[8:], 3) }, "keyblock version 3"},
+		{"preamble version", func(k, p []byte) { le.PutUint32(p[32:], 1) }, "preamble version 1"},
+		{"bootloader below body", func(k, p []byte) { le.PutUint64(p[56:], testLoadAddress+0x1000) }, "below the kernel body"},
+		{"body too small", func(k, p []byte) { le.PutUint64(p[88:], 0x3008) }, "too small"},
+		{"preamble past the end", func(k, p []byte) { le.PutUint64(k[16:], 0x3200) }, "outside the partition"},
+		{"negative preamble offset", func(k, p []byte) { le.PutUint64(k[16:], 1<<63) }, "outside the partition"},
+		{"body past the end", func(k, p []byte) { le.PutUint64(p[0:], 0x2000) }, "outside the partition"},
+		{"body offset wraps", func(k, p []byte) { le.PutUint64(p[0:], 1<<64-0x80) }, "outside the partition"},
+		{"oversized body", func(k, p []byte) { le.PutUint64(p[88:], 0x3011) }, "outside the partition"},
+		{"huge bootloader", func(k, p []byte) { le.PutUint64(p[64:], 1<<64-0x1000) }, "too small"},
+		{"bootloader below load address", func(k, p []byte) { le.PutUint64(p[56:], 0x1000) }, "below the kernel body"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadKernelPartition(testKernelPartition(t, test.set))
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestExtractKernelPartition(t *testing.T) {
+	dir := t.TempDir()
+	entry, err := ExtractKernelPartition(Entry{Name: "kpart", Kernel: testKernelPartition(t, nil)}, dir, "c0ffee00-0000-4000-8000-000000000001", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.Kernel != filepath.Join(dir, "body") {
+		t.Errorf("kernel = %s", entry.Kernel)
+	}
+
+	if want := "console=tty1 root=PARTUUID=c0ffee00-0000-4000-8000-000000000001/PARTNROFF=1"; entry.Cmdline != want {
+		t.Errorf("cmdline = %q, want %q", entry.Cmdline, want)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, "bootloader")); err != nil || string(data) != "bootloader stub!" {
+		t.Errorf("bootloader = %q, %v", data, err)
+	}
+
+	entry, err = ExtractKernelPartition(Entry{Kernel: testKernelPartition(t, nil), Cmdline: "quiet"}, dir, "", nil)
+	if err != nil || entry.Cmdline != "quiet" {
+		t.Errorf("explicit cmdline: got %q, %v", entry.Cmdline, err)
+	}
+}
@@ -0,0 +1,119 @@
+package boot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+)
+
+var DeviceInfoFiles = []string{
+	"deviceinfo",
+	"etc/deviceinfo",
+	"usr/share/deviceinfo/deviceinfo",
+}
+
+func FindDeviceInfo(root string) (map[string]string, error) {
+	for _, name := range DeviceInfoFiles {
+		info, err := ParseDeviceInfo(filepath.Join(root, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		return info, err
+	}
+
+	return nil, os.ErrNotExist
+}
+
+func ParseDeviceInfo(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info := map[string]string{}
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		words, err := shellquote.Split(line)
+		if err != nil || len(words) != 1 {
+			return nil, fmt.Errorf("%s:%d: expected key=\"value\"", path, n+1)
+		}
+
+		key, value, _ := strings.Cut(words[0], "=")
+		info[key] = value
+	}
+
+	return info, nil
+}
+
+func IsPostmarketOS(root string) bool {
+	_, kernel := os.Stat(filepath.Join(root, "vmlinuz"))
+	_, initramfs := os.Stat(filepath.Join(root, "initramfs"))
+	return kernel == nil && initramfs == nil
+}
+
+func PostmarketOSEntry(root string, info map[string]string, bootUUID string, rootUUID string) (Entry, error) {
+	entry := Entry{Name: "postmarketos", Title: "postmarketOS"}
+	if name := info["deviceinfo_name"]; name != "" {
+		entry.Title = fmt.Sprintf("postmarketOS (%s)", name)
+	}
+
+	entry.Kernel = pmosFile(root, "vmlinuz")
+	if entry.Kernel == "" {
+		return entry, errors.New("postmarketOS boot partition has no vmlinuz")
+	}
+
+	if initramfs := pmosFile(root, "initramfs"); initramfs != "" {
+		entry.Ramdisks = []string{initramfs}
+	}
+
+	for _, dtb := range strings.Fields(info["deviceinfo_dtb"]) {
+		for _, name := range []string{"dtbs/" + dtb + ".dtb", dtb + ".dtb", filepath.Base(dtb) + ".dtb"} {
+			if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+				entry.Dtb = name
+				break
+			}
+		}
+
+		if entry.Dtb != "" {
+			break
+		}
+	}
+
+	cmdline := strings.Fields(info["deviceinfo_kernel_cmdline"])
+	if bootUUID != "" {
+		cmdline = append(cmdline, "pmos_boot_uuid="+bootUUID)
+	}
+
+	if rootUUID != "" {
+		cmdline = append(cmdline, "pmos_root_uuid="+rootUUID)
+	}
+
+	entry.Cmdline = strings.Join(cmdline, " ")
+	return entry, nil
+}
+
+func pmosFile(root string, name string) string {
+	if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+		return name
+	}
+
+	files, _ := filepath.Glob(filepath.Join(root, name+"-*"))
+	sort.Strings(files)
+	for _, file := range files {
+		if !strings.HasSuffix(file, "-extra") {
+			return filepath.Base(file)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,118 @@
+package boot
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+const testDeviceInfo = `# Reference: <https://postmarketos.org/deviceinfo>
+deviceinfo_format_version="0"
+deviceinfo_name="Google Lazor Chromebook"
+deviceinfo_arch="aarch64"
+deviceinfo_dtb="qcom/sc7180-trogdor-lazor-r3 qcom/sc7180-trogdor-lazor-r1"
+deviceinfo_kernel_cmdline='console=tty1 quiet'
+`
+
+func TestFindDeviceInfo(t *testing.T) {
+	root := writeTestFiles(t, map[string]string{"usr/share/deviceinfo/deviceinfo": testDeviceInfo})
+
+	info, err := FindDeviceInfo(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info["deviceinfo_name"] != "Google Lazor Chromebook" || info["deviceinfo_kernel_cmdline"] != "console=tty1 quiet" || len(info) != 5 {
+		t.Errorf("got %q", info)
+	}
+
+	if _, err := FindDeviceInfo(t.TempDir()); !os.IsNotExist(err) {
+		t.Errorf("no deviceinfo: got %v", err)
+	}
+
+	root = writeTestFiles(t, map[string]string{"deviceinfo": "deviceinfo_name=two words\n"})
+	if _, err := FindDeviceInfo(root); err == nil {
+		t.Error("unquoted value: expected an error")
+	}
+}
+
+func TestIsPostmarketOS(t *testing.T) {
+	tests := []struct {
+		files []string
+		want  bool
+	}{
+		{[]string{"vmlinuz", "initramfs"}, true},
+		{[]string{"vmlinuz", "initramfs", "initramfs-extra"}, true},
+		{[]string{"vmlinuz"}, false},
+		{[]string{"vmlinuz-6.6.1", "initramfs-6.6.1"}, false},
+		{nil, false},
+	}
+
+	for _, test := range tests {
+		files := map[string]string{}
+		for _, name := range test.files {
+			files[name] = name
+		}
+
+		if got := IsPostmarketOS(writeTestFiles(t, files)); got != test.want {
+			t.Errorf("%q: got %v", test.files, got)
+		}
+	}
+}
+
+func TestPostmarketOSEntry(t *testing.T) {
+	root := writeTestFiles(t, map[string]string{
+		"vmlinuz":                               "kernel",
+		"initramfs":                             "initramfs",
+		"initramfs-extra":                       "extra",
+		"dtbs/qcom/sc7180-trogdor-lazor-r1.dtb": "dtb",
+	})
+
+	info, err := ParseDeviceInfo(writeTestFiles(t, map[string]string{"deviceinfo": testDeviceInfo}) + "/deviceinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := PostmarketOSEntry(root, info, "boot-uuid", "root-uuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Entry{
+		Name:     "postmarketos",
+		Title:    "postmarketOS (Google Lazor Chromebook)",
+		Kernel:   "vmlinuz",
+		Ramdisks: []string{"initramfs"},
+		Dtb:      "dtbs/qcom/sc7180-trogdor-lazor-r1.dtb",
+		Cmdline:  "console=tty1 quiet pmos_boot_uuid=boot-uuid pmos_root_uuid=root-uuid",
+	}
+
+	if !reflect.DeepEqual(entry, want) {
+		t.Errorf("got %+v\nwant %+v", entry, want)
+	}
+
+	root = writeTestFiles(t, map[string]string{
+		"vmlinuz-6.6.1":               "kernel",
+		"initramfs-6.6.1-extra":       "extra",
+		"initramfs-6.6.1":             "initramfs",
+		"sc7180-trogdor-lazor-r3.dtb": "dtb",
+	})
+
+	entry, err = PostmarketOSEntry(root, info, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.Kernel != "vmlinuz-6.6.1" || !reflect.DeepEqual(entry.Ramdisks, []string{"initramfs-6.6.1"}) ||
+		entry.Dtb != "sc7180-trogdor-lazor-r3.dtb" || entry.Cmdline != "console=tty1 quiet" {
+		t.Errorf("versioned files: got %+v", entry)
+	}
+
+	if entry, err := PostmarketOSEntry(t.TempDir(), nil, "", ""); err == nil {
+		t.Errorf("no kernel: got %+v", entry)
+	}
+
+	if entry, _ := PostmarketOSEntry(writeTestFiles(t, map[string]string{"vmlinuz": "kernel"}), nil, "", ""); entry.Title != "postmarketOS" || entry.Ramdisks != nil {
+		t.Errorf("no deviceinfo: got %+v", entry)
+	}
+}
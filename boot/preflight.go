@@ -0,0 +1,199 @@
+package boot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"sideboot/fdt"
+)
+
+var (
+	meminfoPath = "/proc/meminfo"
+	cpuSysfs    = "/sys/devices/system/cpu"
+)
+
+var cmdlineLimits = map[string]int{
+	"amd64": 2048, "386": 2048, "arm64": 2048, "arm": 1024, "riscv64": 1024, "loong64": 4096, "ppc64": 2048, "ppc64le": 2048, "s390x": 4096,
+}
+
+type PreflightError struct {
+	Check  string
+	Reason string
+	Hint   string
+}
+
+func (e *PreflightError) Error() string {
+	return fmt.Sprintf("%s: %s (hint: %s)", e.Check, e.Reason, e.Hint)
+}
+
+type Preflight struct {
+	Kernel  string
+	Ramdisk string
+	Dtb     string
+	Cmdline string
+	header  []byte
+	image   KernelImage
+	arch    string
+}
+
+func (p Preflight) Run() (errs []error, warnings []error) {
+	p.arch = MachineArch()
+
+	f, err := os.Open(p.Kernel)
+	if err != nil {
+		return []error{&PreflightError{"kernel", err.Error(), "check that the kernel path is right"}}, nil
+	}
+
+	p.header = make([]byte, 4096)
+	n, _ := io.ReadFull(f, p.header)
+	f.Close()
+	p.header = p.header[:n]
+	p.image = DetectKernel(p.header)
+
+	for _, check := range []func() *PreflightError{p.checkKernel, p.checkMemory, p.checkCmdline} {
+		if err := check(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, check := range []func() *PreflightError{p.checkCPUs, p.checkDtb} {
+		if err := check(); err != nil {
+			warnings = append(warnings, err)
+		}
+	}
+
+	return errs, warnings
+}
+
+func (p Preflight) checkKernel() *PreflightError {
+	switch {
+	case !p.image.Raw():
+		return &PreflightError{"kernel", fmt.Sprintf("%s is %s-compressed", p.Kernel, p.image.Compression), "unpack it before loading"}
+	case p.image.Format == "":
+		return &PreflightError{"kernel", fmt.Sprintf("%s is not a recognised kernel image", p.Kernel), "point kernel at an Image, zImage or bzImage"}
+	case p.arch != "" && p.image.Arch != p.arch:
+		return &PreflightError{"kernel", fmt.Sprintf("%s is built for %s, this machine is %s", p.Kernel, p.image.Arch, p.arch), "use a kernel built for " + p.arch}
+	case p.Dtb == "" && p.image.Format == "vmlinux":
+		return &PreflightError{"kernel", "kexec_file_load can't load an ELF vmlinux", "use the Image or bzImage of the same build"}
+	case p.Dtb == "" && p.image.Format == "zImage":
+		return &PreflightError{"kernel", "kexec_file_load doesn't support ARM zImage", "set a dtb (sideboot.dtb=running) so kexec-tools loads it"}
+	}
+
+	return nil
+}
+
+func (p Preflight) checkMemory() *PreflightError {
+	available, err := memAvailable()
+	if err != nil {
+		return nil
+	}
+
+	need := fileSize(p.Kernel)
+	if p.image.Format == "Image" && len(p.header) >= 24 {
+		need = max(need, int64(binary.LittleEndian.Uint64(p.header[16:])))
+	}
+
+	need += fileSize(p.Ramdisk) + fileSize(p.Dtb)
+	if need > available {
+		return &PreflightError{"memory", fmt.Sprintf("kernel, initrd and dtb need %d MiB but only %d MiB is available", need>>20, available>>20),
+			"use a smaller or more compressed initrd, or boot with fewer files extracted to /tmp"}
+	}
+
+	return nil
+}
+
+func (p Preflight) checkCPUs() *PreflightError {
+	if p.arch != "arm64" && p.arch != "arm" {
+		return nil
+	}
+
+	cpus, _ := filepath.Glob(filepath.Join(cpuSysfs, "cpu[0-9]*"))
+	for _, cpu := range cpus {
+		if filepath.Base(cpu) == "cpu0" {
+			continue
+		}
+
+		if _, err := os.Stat(filepath.Join(cpu, "online")); err != nil {
+			return &PreflightError{"cpus", fmt.Sprintf("%s can't be taken offline", filepath.Base(cpu)),
+				"the running kernel needs CONFIG_HOTPLUG_CPU and firmware that supports PSCI CPU_OFF, or boot it with nosmp"}
+		}
+	}
+
+	return nil
+}
+
+func (p Preflight) checkDtb() *PreflightError {
+	if p.Dtb == "" {
+		return nil
+	}
+
+	machine, err := fdt.MachineCompatible()
+	if err != nil || len(machine) == 0 {
+		return nil
+	}
+
+	tree, err := fdt.Load(p.Dtb)
+	if err != nil {
+		return &PreflightError{"dtb", err.Error(), "check that the dtb is a flattened device tree"}
+	}
+
+	compatible := tree.Root.Strings("compatible")
+	if fdt.Score(compatible, machine) < 0 {
+		return &PreflightError{"dtb", fmt.Sprintf("%s is for %s, this machine is %s", p.Dtb, strings.Join(compatible, ", "), machine[0]),
+			"set dtb to auto or to the dtb for " + machine[0]}
+	}
+
+	return nil
+}
+
+func (p Preflight) checkCmdline() *PreflightError {
+	limit := cmdlineLimits[p.image.Arch]
+	if p.image.Format == "bzImage" && len(p.header) >= 0x23c && binary.LittleEndian.Uint16(p.header[0x206:]) >= 0x206 {
+		limit = int(binary.LittleEndian.Uint32(p.header[0x238:])) + 1
+	}
+
+	if limit > 0 && len(p.Cmdline) >= limit {
+		return &PreflightError{"cmdline", fmt.Sprintf("cmdline is %d bytes, the kernel accepts at most %d", len(p.Cmdline), limit-1),
+			"drop options the kernel doesn't need or move them to bootconfig"}
+	}
+
+	return nil
+}
+
+func memAvailable() (int64, error) {
+	f, err := os.Open(meminfoPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			return kb << 10, err
+		}
+	}
+
+	return 0, fmt.Errorf("%s: no MemAvailable", meminfoPath)
+}
+
+func fileSize(path string) int64 {
+	if path == "" {
+		return 0
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+
+	return info.Size()
+}
@@ -0,0 +1,164 @@
+package boot
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testPreflight(header []byte, arch string, dtb string, cmdline string) Preflight {
+	return Preflight{Kernel: "vmlinuz", Dtb: dtb, Cmdline: cmdline, header: header, image: DetectKernel(header), arch: arch}
+}
+
+func testHeader(size int, set func([]byte)) []byte {
+	data := make([]byte, size)
+	set(data)
+	return data
+}
+
+func testArm64Header() []byte {
+	return testHeader(4096, func(data []byte) { copy(data[56:], "ARMd") })
+}
+
+func testBzImage(version uint16, cmdlineSize uint32) []byte {
+	le := binary.LittleEndian
+	return testHeader(4096, func(data []byte) {
+		le.PutUint16(data[0x1fe:], 0xaa55)
+		copy(data[0x202:], "HdrS")
+		le.PutUint16(data[0x206:], version)
+		le.PutUint32(data[0x238:], cmdlineSize)
+		data[0x236] = 1
+	})
+}
+
+func TestCheckKernel(t *testing.T) {
+	zImage := testHeader(0x30, func(data []byte) { binary.LittleEndian.PutUint32(data[0x24:], 0x016f2818) })
+	vmlinux := testHeader(64, func(data []byte) {
+		copy(data, "\x7fELF\x02\x01")
+		binary.LittleEndian.PutUint16(data[18:], 183)
+	})
+
+	tests := []struct {
+		name   string
+		p      Preflight
+		reason string
+	}{
+		{"arm64", testPreflight(testArm64Header(), "arm64", "", ""), ""},
+		{"unknown arch", testPreflight(testArm64Header(), "", "", ""), ""},
+		{"arch mismatch", testPreflight(testArm64Header(), "amd64", "", ""), "vmlinuz is built for arm64, this machine is amd64"},
+		{"bzImage on arm64", testPreflight(testBzImage(0x20f, 2047), "arm64", "", ""), "vmlinuz is built for amd64, this machine is arm64"},
+		{"compressed", testPreflight([]byte("\x1f\x8b\x08\x00\x00\x00\x00\x00"), "arm64", "", ""), "vmlinuz is gzip-compressed"},
+		{"not a kernel", testPreflight([]byte("not a kernel"), "arm64", "", ""), "vmlinuz is not a recognised kernel image"},
+		{"vmlinux", testPreflight(vmlinux, "arm64", "", ""), "kexec_file_load can't load an ELF vmlinux"},
+		{"vmlinux with dtb", testPreflight(vmlinux, "arm64", "board.dtb", ""), ""},
+		{"zImage", testPreflight(zImage, "arm", "", ""), "kexec_file_load doesn't support ARM zImage"},
+		{"zImage with dtb", testPreflight(zImage, "arm", "board.dtb", ""), ""},
+	}
+
+	for _, test := range tests {
+		err := test.p.checkKernel()
+		if test.reason == "" && err != nil || test.reason != "" && (err == nil || err.Reason != test.reason) {
+			t.Errorf("%s: got %v, want %q", test.name, err, test.reason)
+		}
+	}
+}
+
+func TestCheckCmdline(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       Preflight
+		failing bool
+	}{
+		{"arm64 limit", testPreflight(testArm64Header(), "arm64", "", strings.Repeat("a", 2047)), false},
+		{"arm64 too long", testPreflight(testArm64Header(), "arm64", "", strings.Repeat("a", 2048)), true},
+		{"bzImage cmdline_size", testPreflight(testBzImage(0x20f, 4095), "amd64", "", strings.Repeat("a", 4095)), false},
+		{"bzImage too long", testPreflight(testBzImage(0x20f, 4095), "amd64", "", strings.Repeat("a", 4096)), true},
+		{"bzImage before 2.06", testPreflight(testBzImage(0x205, 4095), "amd64", "", strings.Repeat("a", 2048)), true},
+		{"unknown kernel", testPreflight([]byte("not a kernel"), "", "", strings.Repeat("a", 8192)), false},
+	}
+
+	for _, test := range tests {
+		if err := test.p.checkCmdline(); (err != nil) != test.failing {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+	}
+}
+
+func setPreflightPaths(t *testing.T, meminfo string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "meminfo"), []byte(meminfo), 0o644)
+	meminfoPath, cpuSysfs = filepath.Join(dir, "meminfo"), filepath.Join(dir, "cpu")
+	t.Cleanup(func() { meminfoPath, cpuSysfs = "/proc/meminfo", "/sys/devices/system/cpu" })
+}
+
+func TestMemAvailable(t *testing.T) {
+	setPreflightPaths(t, "MemTotal:        3911140 kB\nMemFree:          163724 kB\nMemAvailable:    2013528 kB\nBuffers:          114736 kB\n")
+	if available, err := memAvailable(); err != nil || available != 2013528<<10 {
+		t.Errorf("got %d, %v", available, err)
+	}
+
+	setPreflightPaths(t, "MemTotal:        3911140 kB\nMemFree:          163724 kB\n")
+	if _, err := memAvailable(); err == nil {
+		t.Error("no MemAvailable: expected an error")
+	}
+
+	setPreflightPaths(t, "MemAvailable:    lots kB\n")
+	if _, err := memAvailable(); err == nil {
+		t.Error("bad MemAvailable: expected an error")
+	}
+}
+
+func TestCheckMemory(t *testing.T) {
+	kernel := filepath.Join(t.TempDir(), "Image")
+	header := testHeader(4096, func(data []byte) {
+		copy(data[56:], "ARMd")
+		binary.LittleEndian.PutUint64(data[16:], 32<<20)
+	})
+	os.WriteFile(kernel, header, 0o644)
+
+	p := testPreflight(header, "arm64", "", "")
+	p.Kernel = kernel
+
+	setPreflightPaths(t, "MemAvailable:    65536 kB\n")
+	if err := p.checkMemory(); err != nil {
+		t.Errorf("64 MiB available: got %v", err)
+	}
+
+	setPreflightPaths(t, "MemAvailable:    16384 kB\n")
+	if err := p.checkMemory(); err == nil || err.Reason != "kernel, initrd and dtb need 32 MiB but only 16 MiB is available" {
+		t.Errorf("16 MiB available: got %v", err)
+	}
+
+	setPreflightPaths(t, "")
+	if err := p.checkMemory(); err != nil {
+		t.Errorf("unknown MemAvailable: got %v", err)
+	}
+}
+
+func TestCheckCPUs(t *testing.T) {
+	setPreflightPaths(t, "")
+	for _, dir := range []string{"cpu0", "cpu1", "cpufreq", "cpuidle"} {
+		os.MkdirAll(filepath.Join(cpuSysfs, dir), 0o755)
+	}
+
+	os.WriteFile(filepath.Join(cpuSysfs, "cpu1/online"), []byte("1\n"), 0o644)
+
+	p := testPreflight(testArm64Header(), "arm64", "", "")
+	if err := p.checkCPUs(); err != nil {
+		t.Errorf("hotpluggable cpus: got %v", err)
+	}
+
+	os.MkdirAll(filepath.Join(cpuSysfs, "cpu2"), 0o755)
+	if err := p.checkCPUs(); err == nil || err.Reason != "cpu2 can't be taken offline" {
+		t.Errorf("cpu2 without online: got %v", err)
+	}
+
+	p.arch = "amd64"
+	if err := p.checkCPUs(); err != nil {
+		t.Errorf("amd64: got %v", err)
+	}
+}
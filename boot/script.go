@@ -0,0 +1,275 @@
+package boot
+
+import (
+	"fmt"
+	"strings"
+)
+
+var scriptReserved = map[string]bool{
+	"then": true, "else": true, "fi": true, "do": true, "done": true, "}": true,
+}
+
+func parseScript(data string) ([]scriptCmd, error) {
+	parser := &scriptParser{lexer: &scriptLexer{data: data}}
+	cmds, _, err := parser.block()
+	return cmds, err
+}
+
+type scriptCmd struct {
+	words    []string
+	line     int
+	body     []scriptCmd
+	branches []scriptBranch
+}
+
+type scriptBranch struct {
+	cond []string
+	body []scriptCmd
+}
+
+type scriptLexer struct {
+	data string
+	pos  int
+	line int
+}
+
+func (l *scriptLexer) next() (string, int, bool) {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case c == '\\' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '\n':
+			l.pos += 2
+			l.line++
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' {
+				l.pos++
+			}
+		case c == '\n':
+			l.pos++
+			l.line++
+			return ";", l.line - 1, true
+		case c == ';':
+			l.pos++
+			return ";", l.line, true
+		default:
+			return l.word()
+		}
+	}
+
+	return "", l.line, false
+}
+
+func (l *scriptLexer) word() (string, int, bool) {
+	start, line := l.pos, l.line
+	var quote byte
+
+	for ; l.pos < len(l.data); l.pos++ {
+		c := l.data[l.pos]
+		if c == '\n' {
+			l.line++
+		}
+
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+		case c == '\\':
+			l.pos++
+			if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+				l.line++
+			}
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == ';':
+			if c == '\n' {
+				l.line--
+			}
+
+			return l.data[start:l.pos], line, true
+		}
+	}
+
+	return l.data[start:min(l.pos, len(l.data))], line, true
+}
+
+type scriptParser struct {
+	lexer   *scriptLexer
+	pending string
+	line    int
+}
+
+func (p *scriptParser) command() ([]string, int, bool) {
+	if p.pending != "" {
+		words := []string{p.pending}
+		p.pending = ""
+		return words, p.line, true
+	}
+
+	words := []string{}
+	for {
+		tok, line, ok := p.lexer.next()
+		if !ok {
+			return words, p.line, len(words) > 0
+		}
+
+		if tok == ";" {
+			if len(words) > 0 {
+				return words, p.line, true
+			}
+
+			continue
+		}
+
+		if len(words) == 0 {
+			p.line = line + 1
+		}
+
+		if tok == "}" && len(words) > 0 {
+			p.pending = tok
+			return words, p.line, true
+		}
+
+		words = append(words, tok)
+		if tok == "{" || (len(words) == 1 && scriptReserved[tok]) {
+			return words, p.line, true
+		}
+	}
+}
+
+func (p *scriptParser) block(terminators ...string) ([]scriptCmd, []string, error) {
+	cmds := []scriptCmd{}
+	for {
+		words, line, ok := p.command()
+		if !ok {
+			if len(terminators) > 0 {
+				return nil, nil, fmt.Errorf("line %d: missing %s", p.lexer.line, strings.Join(terminators, " or "))
+			}
+
+			return cmds, nil, nil
+		}
+
+		for _, term := range terminators {
+			if words[0] == term {
+				return cmds, words, nil
+			}
+		}
+
+		if len(words) == 1 && words[0] == "{" {
+			if len(cmds) == 0 || cmds[len(cmds)-1].body != nil || cmds[len(cmds)-1].branches != nil {
+				return nil, nil, fmt.Errorf("line %d: { without a command", line)
+			}
+
+			body, _, err := p.block("}")
+			if err != nil {
+				return nil, nil, err
+			}
+
+			cmds[len(cmds)-1].body = body
+			continue
+		}
+
+		cmd := scriptCmd{words: words, line: line}
+
+		switch words[0] {
+		case "if":
+			cond := words[1:]
+			for {
+				if then, _, ok := p.command(); !ok || then[0] != "then" {
+					return nil, nil, fmt.Errorf("line %d: expected then after if", line)
+				}
+
+				body, term, err := p.block("elif", "else", "fi")
+				if err != nil {
+					return nil, nil, err
+				}
+
+				cmd.branches = append(cmd.branches, scriptBranch{cond: cond, body: body})
+
+				if term[0] == "else" {
+					body, _, err := p.block("fi")
+					if err != nil {
+						return nil, nil, err
+					}
+
+					cmd.branches = append(cmd.branches, scriptBranch{body: body})
+				}
+
+				if term[0] != "elif" {
+					break
+				}
+
+				cond = term[1:]
+			}
+		case "for", "while", "until":
+			if _, _, err := p.block("done"); err != nil {
+				return nil, nil, err
+			}
+		default:
+			if words[len(words)-1] == "{" {
+				body, _, err := p.block("}")
+				if err != nil {
+					return nil, nil, err
+				}
+
+				cmd.words = words[:len(words)-1]
+				cmd.body = body
+			}
+		}
+
+		cmds = append(cmds, cmd)
+	}
+}
+
+func expandVars(word string, vars map[string]string) string {
+	var out strings.Builder
+	var quote byte
+
+	for i := 0; i < len(word); i++ {
+		c := word[i]
+		switch {
+		case quote == '\'' && c == '\'':
+			quote = 0
+		case quote == '\'':
+			out.WriteByte(c)
+		case c == '\\' && i+1 < len(word):
+			i++
+			out.WriteByte(word[i])
+		case c == '"' && quote == '"':
+			quote = 0
+		case (c == '"' || c == '\'') && quote == 0:
+			quote = c
+		case c == '$':
+			name := ""
+			if i+1 < len(word) && word[i+1] == '{' {
+				end := strings.IndexByte(word[i:], '}')
+				if end < 0 {
+					end = len(word) - i
+				}
+
+				name = word[i+2 : i+end]
+				i += end
+			} else {
+				j := i + 1
+				for j < len(word) && (isVersionLetter(rune(word[j])) || isVersionDigit(rune(word[j])) || word[j] == '_') {
+					j++
+				}
+
+				name = word[i+1 : j]
+				i = j - 1
+			}
+
+			out.WriteString(vars[name])
+		default:
+			out.WriteByte(c)
+		}
+	}
+
+	return out.String()
+}
@@ -0,0 +1,193 @@
+package boot
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func scriptWords(cmds []scriptCmd) []string {
+	out := []string{}
+	for _, cmd := range cmds {
+		out = append(out, strings.Join(cmd.words, " "))
+		if cmd.body != nil {
+			out = append(out, "{", strings.Join(scriptWords(cmd.body), "; "), "}")
+		}
+
+		for _, branch := range cmd.branches {
+			out = append(out, "["+strings.Join(branch.cond, " ")+"] "+strings.Join(scriptWords(branch.body), "; "))
+		}
+	}
+
+	return out
+}
+
+func TestParseScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "simple",
+			script: "set a=1\nset b=2; echo x",
+			want:   []string{"set a=1", "set b=2", "echo x"},
+		},
+		{
+			name:   "brace on same line",
+			script: "function load_video {\n  insmod all_video\n}\nload_video",
+			want:   []string{"function load_video", "{", "insmod all_video", "}", "load_video"},
+		},
+		{
+			name:   "brace on own line",
+			script: "function load_video\n{\n  insmod all_video\n}\nload_video",
+			want:   []string{"function load_video", "{", "insmod all_video", "}", "load_video"},
+		},
+		{
+			name:   "menuentry brace on own line",
+			script: "menuentry 'Linux' --class gnu\n{\n\tlinux /vmlinuz\n\tinitrd /initrd\n}",
+			want:   []string{"menuentry 'Linux' --class gnu", "{", "linux /vmlinuz; initrd /initrd", "}"},
+		},
+		{
+			name:   "if",
+			script: "if [ a ]; then\n  set x=1\nfi",
+			want:   []string{"if [ a ]", "[[ a ]] set x=1"},
+		},
+		{
+			name:   "if else",
+			script: "if [ a ]\nthen\n  set x=1\nelse\n  set x=2\nfi",
+			want:   []string{"if [ a ]", "[[ a ]] set x=1", "[] set x=2"},
+		},
+		{
+			name:   "if elif else",
+			script: "if [ a ]; then set x=1; elif [ b ]; then set x=2; elif [ c ]; then set x=3; else set x=4; fi; echo done",
+			want:   []string{"if [ a ]", "[[ a ]] set x=1", "[[ b ]] set x=2", "[[ c ]] set x=3", "[] set x=4", "echo done"},
+		},
+		{
+			name:   "nested if",
+			script: "if a; then\n if b; then\n  set x=1\n fi\nfi",
+			want:   []string{"if a", "[a] if b; [b] set x=1"},
+		},
+		{
+			name:   "comments and continuation",
+			script: "# comment\nlinux /vmlinuz \\\n  root=/dev/sda1 # trailing\n",
+			want:   []string{"linux /vmlinuz root=/dev/sda1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmds, err := parseScript(test.script)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := scriptWords(cmds); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseScriptErrors(t *testing.T) {
+	for _, script := range []string{
+		"{\necho x\n}",
+		"if a; then echo x",
+		"if a\necho x\nfi",
+		"if a; then echo x; else echo y",
+		"function f {\necho x",
+		"function f {\n}\n{\n}",
+	} {
+		if _, err := parseScript(script); err == nil {
+			t.Errorf("%q: expected an error", script)
+		}
+	}
+}
+
+func TestParseScriptWords(t *testing.T) {
+	for _, script := range []string{
+		"{",
+		"}",
+		";;;",
+		"f\n{\n}",
+		"if a; then\n{\n}\nfi",
+		"menuentry x\n{\n{\n}\n}",
+	} {
+		cmds, _ := parseScript(script)
+		var check func([]scriptCmd)
+		check = func(cmds []scriptCmd) {
+			for _, cmd := range cmds {
+				if len(cmd.words) == 0 {
+					t.Errorf("%q: command without words", script)
+				}
+
+				check(cmd.body)
+				for _, branch := range cmd.branches {
+					check(branch.body)
+				}
+			}
+		}
+
+		check(cmds)
+	}
+}
+
+func TestGrubOwnLineBraces(t *testing.T) {
+	root := t.TempDir()
+	cfg := `set default=0
+function load_video
+{
+  insmod all_video
+}
+menuentry 'Arch Linux'
+{
+  load_video
+  linux /vmlinuz-linux root=UUID=1234 rw
+  initrd /initramfs-linux.img
+}
+`
+	if err := os.MkdirAll(filepath.Join(root, "boot/grub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "boot/grub/grub.cfg"), []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ScanGrub(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(got.Entries))
+	}
+
+	entry := got.Entries[0]
+	if entry.Title != "Arch Linux" || entry.Cmdline != "root=UUID=1234 rw" || len(entry.Ramdisks) != 1 {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+}
+
+func TestBootScrOwnLineBraces(t *testing.T) {
+	root := t.TempDir()
+	script := "setenv bootargs console=ttyS0\nfoo\n{\n}\nload mmc 0:1 ${kernel_addr_r} Image\nbooti ${kernel_addr_r} - ${fdtcontroladdr}\n"
+	if err := os.WriteFile(filepath.Join(root, "boot.cmd"), []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "Image"), []byte("kernel"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := ParseBootScrFile(root, "boot.cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.Kernel != "Image" || entry.Cmdline != "console=ttyS0" {
+		t.Errorf("got %+v", entry)
+	}
+}
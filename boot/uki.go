@@ -0,0 +1,159 @@
+package boot
+
+import (
+	"debug/pe"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func ScanUKI(root string) (*Config, error) {
+	files, err := filepath.Glob(filepath.Join(root, "EFI/Linux/*.efi"))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool { return CompareVersions(files[i], files[j]) > 0 })
+
+	cfg := &Config{}
+	for _, file := range files {
+		name, _ := filepath.Rel(root, file)
+		entry, err := ReadUKI(root, name)
+		if err != nil {
+			log.Print("uki: ", err)
+			continue
+		}
+
+		cfg.Entries = append(cfg.Entries, entry)
+	}
+
+	return cfg, nil
+}
+
+func IsUKI(path string) bool {
+	f, err := pe.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	return f.Section(".linux") != nil
+}
+
+func ReadUKI(root string, name string) (Entry, error) {
+	f, err := pe.Open(filepath.Join(root, name))
+	if err != nil {
+		return Entry{}, fmt.Errorf("%s: %w", name, err)
+	}
+	defer f.Close()
+
+	if f.Section(".linux") == nil {
+		return Entry{}, fmt.Errorf("%s: no .linux section", name)
+	}
+
+	entry := Entry{
+		Name:   strings.TrimSuffix(filepath.Base(name), ".efi"),
+		Kernel: name,
+	}
+
+	if data, err := ukiSection(f, ".osrel"); err == nil {
+		osrel := parseOSRelease(string(data))
+		entry.Title = osrel["PRETTY_NAME"]
+		if entry.Title == "" {
+			entry.Title = osrel["NAME"]
+		}
+
+		if version := osrel["VERSION_ID"]; version != "" && entry.Title != "" && !strings.Contains(entry.Title, version) {
+			entry.Title = fmt.Sprintf("%s (%s)", entry.Title, version)
+		}
+	}
+
+	if data, err := ukiSection(f, ".uname"); err == nil && entry.Title != "" {
+		entry.Title = fmt.Sprintf("%s %s", entry.Title, strings.TrimSpace(string(data)))
+	}
+
+	return entry, nil
+}
+
+func ExtractUKI(entry Entry, dir string) (Entry, error) {
+	f, err := pe.Open(entry.Kernel)
+	if err != nil {
+		return entry, fmt.Errorf("%s: %w", entry.Kernel, err)
+	}
+	defer f.Close()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return entry, err
+	}
+
+	extract := func(section string) (string, error) {
+		data, err := ukiSection(f, section)
+		if err != nil {
+			return "", err
+		}
+
+		path := filepath.Join(dir, strings.TrimPrefix(section, "."))
+		return path, os.WriteFile(path, data, 0o644)
+	}
+
+	uki := entry.Kernel
+	if entry.Kernel, err = extract(".linux"); err != nil {
+		return entry, fmt.Errorf("%s: %w", uki, err)
+	}
+
+	if initrd, err := extract(".initrd"); err == nil {
+		entry.Ramdisks = append([]string{initrd}, entry.Ramdisks...)
+	}
+
+	if entry.Dtb == "" {
+		if dtb, err := extract(".dtb"); err == nil {
+			entry.Dtb = dtb
+		}
+	}
+
+	if data, err := ukiSection(f, ".cmdline"); err == nil && entry.Cmdline == "" {
+		entry.Cmdline = strings.Trim(string(data), " \t\n\x00")
+	}
+
+	return entry, nil
+}
+
+func ukiSection(f *pe.File, name string) ([]byte, error) {
+	section := f.Section(name)
+	if section == nil {
+		return nil, fmt.Errorf("no %s section", name)
+	}
+
+	data, err := section.Data()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	if section.VirtualSize > 0 && int(section.VirtualSize) < len(data) {
+		data = data[:section.VirtualSize]
+	}
+
+	if len(data) == 0 {
+		return nil, errors.New(name + " section is empty")
+	}
+
+	return data, nil
+}
+
+func parseOSRelease(data string) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(data, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+
+		values[key] = strings.Trim(value, `"'`)
+	}
+
+	return values
+}
@@ -0,0 +1,166 @@
+package boot
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type ukiSectionData struct {
+	name string
+	data string
+}
+
+func writeUKI(t *testing.T, path string, sections ...ukiSectionData) {
+	t.Helper()
+
+	le := binary.LittleEndian
+	headers := 0x80 + 24 + 40*len(sections)
+	image := make([]byte, headers)
+	copy(image, "MZ")
+	le.PutUint32(image[0x3c:], 0x80)
+	copy(image[0x80:], "PE\x00\x00")
+	le.PutUint16(image[0x84:], 0xaa64)
+	le.PutUint16(image[0x86:], uint16(len(sections)))
+
+	for i, section := range sections {
+		for len(image)%16 != 0 {
+			image = append(image, 0)
+		}
+
+		header := image[0x80+24+40*i:]
+		copy(header, section.name)
+		le.PutUint32(header[8:], uint32(len(section.data)))
+		le.PutUint32(header[12:], uint32(0x1000*(i+1)))
+		le.PutUint32(header[16:], uint32(len(section.data)+15)&^15)
+		le.PutUint32(header[20:], uint32(len(image)))
+		image = append(image, section.data...)
+		image = append(image, make([]byte, (16-len(section.data)%16)%16)...)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, image, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadUKI(t *testing.T) {
+	root := t.TempDir()
+	writeUKI(t, filepath.Join(root, "EFI/Linux/fedora-6.8.9.efi"),
+		ukiSectionData{".osrel", "NAME=\"Fedora Linux\"\nVERSION_ID=40\nPRETTY_NAME=\"Fedora Linux 40 (Forty)\"\n"},
+		ukiSectionData{".uname", "6.8.9-300.fc40.aarch64\n"},
+		ukiSectionData{".linux", "kernel"},
+	)
+	writeUKI(t, filepath.Join(root, "alpine.efi"),
+		ukiSectionData{".osrel", "# os-release\nNAME='Alpine Linux'\nVERSION_ID=3.20.1\n"},
+		ukiSectionData{".linux", "kernel"},
+	)
+	writeUKI(t, filepath.Join(root, "bare.efi"), ukiSectionData{".linux", "kernel"})
+	writeUKI(t, filepath.Join(root, "stub.efi"), ukiSectionData{".text", "stub"})
+	os.WriteFile(filepath.Join(root, "garbage.efi"), []byte("not a PE file"), 0o644)
+
+	tests := []struct {
+		name string
+		want Entry
+	}{
+		{"EFI/Linux/fedora-6.8.9.efi", Entry{Name: "fedora-6.8.9", Title: "Fedora Linux 40 (Forty) 6.8.9-300.fc40.aarch64", Kernel: "EFI/Linux/fedora-6.8.9.efi"}},
+		{"alpine.efi", Entry{Name: "alpine", Title: "Alpine Linux (3.20.1)", Kernel: "alpine.efi"}},
+		{"bare.efi", Entry{Name: "bare", Kernel: "bare.efi"}},
+	}
+
+	for _, test := range tests {
+		entry, err := ReadUKI(root, test.name)
+		if err != nil || !reflect.DeepEqual(entry, test.want) {
+			t.Errorf("%s: got %+v, %v", test.name, entry, err)
+		}
+
+		if !IsUKI(filepath.Join(root, test.name)) {
+			t.Errorf("%s: not recognised as a UKI", test.name)
+		}
+	}
+
+	for _, name := range []string{"stub.efi", "garbage.efi", "missing.efi"} {
+		if _, err := ReadUKI(root, name); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+
+		if IsUKI(filepath.Join(root, name)) {
+			t.Errorf("%s: recognised as a UKI", name)
+		}
+	}
+}
+
+func TestExtractUKI(t *testing.T) {
+	root := t.TempDir()
+	uki := filepath.Join(root, "linux.efi")
+	writeUKI(t, uki,
+		ukiSectionData{".linux", "arm64 kernel"},
+		ukiSectionData{".initrd", "initramfs"},
+		ukiSectionData{".dtb", "device tree"},
+		ukiSectionData{".cmdline", "root=UUID=1234 ro quiet\n\x00"},
+		ukiSectionData{".splash", ""},
+	)
+
+	dir := filepath.Join(root, "extracted")
+	entry, err := ExtractUKI(Entry{Name: "linux", Kernel: uki, Ramdisks: []string{"microcode.img"}}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Entry{
+		Name:     "linux",
+		Kernel:   filepath.Join(dir, "linux"),
+		Ramdisks: []string{filepath.Join(dir, "initrd"), "microcode.img"},
+		Dtb:      filepath.Join(dir, "dtb"),
+		Cmdline:  "root=UUID=1234 ro quiet",
+	}
+
+	if !reflect.DeepEqual(entry, want) {
+		t.Errorf("got %+v\nwant %+v", entry, want)
+	}
+
+	for file, data := range map[string]string{"linux": "arm64 kernel", "initrd": "initramfs", "dtb": "device tree"} {
+		if got, _ := os.ReadFile(filepath.Join(dir, file)); string(got) != data {
+			t.Errorf("%s: got %q", file, got)
+		}
+	}
+
+	entry, err = ExtractUKI(Entry{Kernel: uki, Dtb: "board.dtb", Cmdline: "console=ttyS0"}, dir)
+	if err != nil || entry.Dtb != "board.dtb" || entry.Cmdline != "console=ttyS0" {
+		t.Errorf("entry overrides: got %+v, %v", entry, err)
+	}
+
+	stub := filepath.Join(root, "stub.efi")
+	writeUKI(t, stub, ukiSectionData{".linux", ""})
+	if _, err := ExtractUKI(Entry{Kernel: stub}, dir); err == nil {
+		t.Error("empty .linux: expected an error")
+	}
+}
+
+func TestScanUKI(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"linux-6.8.efi", "linux-6.9.efi", "linux-6.10.efi", "linux-6.10-rc7.efi"} {
+		writeUKI(t, filepath.Join(root, "EFI/Linux", name), ukiSectionData{".linux", "kernel"})
+	}
+
+	os.WriteFile(filepath.Join(root, "EFI/Linux/broken.efi"), []byte("not a PE file"), 0o644)
+
+	cfg, err := ScanUKI(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, entry := range cfg.Entries {
+		names = append(names, entry.Name)
+	}
+
+	if !reflect.DeepEqual(names, []string{"linux-6.10", "linux-6.10-rc7", "linux-6.9", "linux-6.8"}) {
+		t.Errorf("got %q", names)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"syscall"
+
+	"sideboot/boot"
+	"sideboot/probe"
+	"sideboot/sysinit"
+)
+
+const discoverTimeout = 5
+
+func discoverBoot() bool {
+	sysinit.FirmwareReady()
+
+	cfg := discoverEntries()
+	if len(cfg.Entries) == 0 {
+		bootMsg = "no boot partition has been specified and none has been found"
+		return false
+	}
+
+	if sysinit.Args[defaultOption] != "" {
+		cfg.Default = sysinit.Args[defaultOption]
+	}
+
+	entry, ok := choose(cfg)
+	if !ok {
+		bootMsg = "user gesture interrupted boot"
+		return false
+	}
+
+	if bootEntry(entry, "") {
+		return true
+	}
+
+	os.Chdir("/")
+	return false
+}
+
+func discoverEntries() *boot.Config {
+	cfg := &boot.Config{}
+
+	devices, err := probe.Devices()
+	if err != nil {
+		log.Print("discover: ", err)
+		return cfg
+	}
+
+	for _, dev := range devices {
+		if !dev.Mountable() {
+			continue
+		}
+
+		found, name, err := scanDevice(dev)
+		if err != nil {
+			log.Printf("discover: %s: %s", dev.Path, err)
+			continue
+		}
+
+		if len(found.Entries) == 0 {
+			continue
+		}
+
+		log.Printf("discover: %s: %d entries for %s", dev.Path, len(found.Entries), name)
+
+		def, _ := found.DefaultEntry()
+		for _, entry := range found.Entries {
+			if entry.Partition == "" {
+				entry.Partition = dev.Path
+			}
+
+			if entry.Name == def.Name && cfg.Default == "" {
+				cfg.Default = dev.Name + "/" + entry.Name
+			}
+
+			if len(found.Entries) == 1 {
+				entry.Title = fmt.Sprintf("%s (%s)", name, dev.Name)
+			} else {
+				entry.Title = fmt.Sprintf("%s (%s): %s", name, dev.Name, entry.Label())
+			}
+
+			entry.Name = dev.Name + "/" + entry.Name
+			cfg.Entries = append(cfg.Entries, entry)
+		}
+
+		if cfg.Timeout == 0 {
+			cfg.Timeout = found.Timeout
+		}
+	}
+
+	kparts, err := scanKernelPartitions()
+	if err != nil {
+		log.Print("discover: ", err)
+	} else {
+		cfg.Merge(kparts)
+	}
+
+	if cfg.Timeout == 0 {
+		cfg.Timeout = discoverTimeout
+	}
+
+	return cfg
+}
+
+func scanDevice(dev *probe.Device) (*boot.Config, string, error) {
+	if err := mountDevice(dev, "/tmp/scan"); err != nil {
+		return nil, "", err
+	}
+
+	defer func() {
+		os.Chdir("/")
+		syscall.Unmount("/tmp/scan", 0)
+	}()
+
+	if err := os.Chdir("/tmp/scan"); err != nil {
+		return nil, "", err
+	}
+
+	found, err := boot.ParseFile("sideboot.cfg")
+	switch {
+	case os.IsNotExist(err):
+		found = &boot.Config{}
+	case err != nil:
+		return nil, "", fmt.Errorf("sideboot.cfg: %w", err)
+	}
+
+	entry, explicit := optionsEntry(found.Options)
+	if explicit {
+		found.Entries = append([]boot.Entry{entry}, found.Entries...)
+		if found.Default == "" {
+			found.Default = entry.Name
+		}
+	}
+
+	timeout := found.Timeout
+	found.Merge(scanRoot("/tmp/scan", dev.Path))
+	if explicit {
+		found.Timeout = timeout
+	}
+
+	name := boot.OSName("/tmp/scan")
+	if len(found.Entries) == 0 {
+		kernels, _ := boot.ScanKernels("/tmp/scan")
+		if spec := rootSpec(dev); name != "" && spec != "" {
+			for i := range kernels.Entries {
+				kernels.Entries[i].Cmdline = fmt.Sprintf("root=%s ro rootwait %s", spec, sysinit.Args[cmdlineOption])
+			}
+		}
+
+		found.Merge(kernels)
+	}
+
+	for _, fallback := range []string{dev.Label, dev.PartLabel, dev.Name} {
+		if name == "" {
+			name = fallback
+		}
+	}
+
+	return found, name, nil
+}
+
+func optionsEntry(options []string) (boot.Entry, bool) {
+	args := map[string]string{}
+	for _, option := range options {
+		key, value, _ := strings.Cut(option, "=")
+		args[key] = value
+	}
+
+	entry := boot.Entry{
+		Name:    "sideboot",
+		Kernel:  args[kernelOption],
+		Vendor:  args[vendorOption],
+		Cmdline: args[cmdlineOption],
+	}
+
+	if args[ramdiskOption] != "" {
+		entry.Ramdisks = strings.Split(args[ramdiskOption], ",")
+	}
+
+	return entry, entry.Kernel != ""
+}
+
+func rootSpec(dev *probe.Device) string {
+	switch {
+	case dev.PartUUID != "":
+		return "PARTUUID=" + dev.PartUUID
+	case dev.UUID != "":
+		return "UUID=" + dev.UUID
+	}
+
+	return ""
+}
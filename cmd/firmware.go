@@ -0,0 +1,60 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+
+	"sideboot/probe"
+	"sideboot/sysinit"
+)
+
+var firmwarePartitions = map[string]string{
+	"modem":       "image",
+	"apnhlos":     "image",
+	"bluetooth":   "image",
+	"modem_a":     "image",
+	"bluetooth_a": "image",
+}
+
+func mountFirmwarePartitions() {
+	devices, err := probe.Devices()
+	if err != nil {
+		log.Print("firmware: ", err)
+		return
+	}
+
+	for _, dev := range devices {
+		subdir, ok := firmwarePartitions[strings.ToLower(dev.PartLabel)]
+		if !ok || !dev.Mountable() {
+			continue
+		}
+
+		target := filepath.Join("/tmp/firmware", dev.Name)
+		if err := mountDevice(dev, target); err != nil {
+			log.Print("firmware: ", err)
+			continue
+		}
+
+		log.Printf("firmware: serving %s from %s", dev.PartLabel, dev.Path)
+		sysinit.AddFirmwareDir(filepath.Join(target, subdir), true)
+	}
+}
+
+func bootFirmwareDirs(root string) []string {
+	names := []string{"firmware", "lib/firmware"}
+	if sysinit.Args[firmwareOption] != "" {
+		names = []string{sysinit.Args[firmwareOption]}
+	}
+
+	dirs := []string{}
+	for _, name := range names {
+		if dir := filepath.Join(root, name); sysinit.FileExist(dir) {
+			sysinit.AddFirmwareDir(dir, false)
+			dirs = append(dirs, dir)
+		}
+	}
+
+	sysinit.FirmwareReady()
+	return dirs
+}
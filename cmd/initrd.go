@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"sideboot/boot"
+	"sideboot/probe"
+	"sideboot/sysinit"
+)
+
+type bootInfo struct {
+	Entry     string   `json:"entry"`
+	Title     string   `json:"title,omitempty"`
+	Partition string   `json:"partition"`
+	Slot      string   `json:"slot,omitempty"`
+	Kernel    string   `json:"kernel"`
+	Ramdisks  []string `json:"ramdisks,omitempty"`
+	Dtb       string   `json:"dtb,omitempty"`
+	Overlays  []string `json:"overlays,omitempty"`
+	Cmdline   string   `json:"cmdline"`
+}
+
+func initrdFiles(entry boot.Entry) []boot.InitrdFile {
+	files := entry.Files
+	for _, item := range strings.Split(sysinit.Args[initrdOption], ",") {
+		if target, source, ok := strings.Cut(item, ":"); ok {
+			files = append(files, boot.InitrdFile{Target: target, Source: source})
+		}
+	}
+
+	return files
+}
+
+func readInitrdSource(file boot.InitrdFile) ([]boot.CpioFile, error) {
+	source := file.Source
+	if spec, rel, ok := strings.Cut(source, ":"); ok && strings.Contains(spec, "=") {
+		dev, err := probe.Resolve(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		target := filepath.Join("/tmp/initrd-src", dev.Name)
+		if err := mountDevice(dev, target); err != nil {
+			return nil, fmt.Errorf("%s: %w", spec, err)
+		}
+		defer syscall.Unmount(target, 0)
+
+		source = filepath.Join(target, rel)
+	}
+
+	return boot.ReadInitrdFiles(file.Target, source)
+}
+
+func composeInitrd(entry boot.Entry, bootPartition string, slot string, cmdline string) (string, error) {
+	files := []boot.CpioFile{}
+	for _, file := range initrdFiles(entry) {
+		found, err := readInitrdSource(file)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", file.Target, err)
+		}
+
+		log.Printf("initrd: adding %s from %s", file.Target, file.Source)
+		files = append(files, found...)
+	}
+
+	if len(files) > 0 || sysinit.Args[bootJSONOption] == "1" {
+		info := bootInfo{
+			Entry:     entry.Name,
+			Title:     entry.Title,
+			Partition: bootPartition,
+			Slot:      slot,
+			Kernel:    entry.Kernel,
+			Ramdisks:  entry.Ramdisks,
+			Dtb:       entry.Dtb,
+			Overlays:  entry.Overlays,
+			Cmdline:   cmdline,
+		}
+
+		data, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return "", err
+		}
+
+		files = append(files, boot.CpioFile{Name: "etc/sideboot/boot.json", Mode: 0o644, Data: append(data, '\n')})
+	}
+
+	if len(files) == 0 && len(entry.Ramdisks) <= 1 {
+		if len(entry.Ramdisks) == 0 {
+			return "", nil
+		}
+
+		return entry.Ramdisks[0], nil
+	}
+
+	out := "/tmp/initrd/initrd.img"
+	if err := boot.ComposeInitrd(out, entry.Ramdisks, files); err != nil {
+		return "", err
+	}
+
+	log.Printf("initrd: composed %s from %d ramdisks and %d files", out, len(entry.Ramdisks), len(files))
+	return out, nil
+}
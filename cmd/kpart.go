@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sideboot/boot"
+	"sideboot/gpt"
+	"sideboot/probe"
+)
+
+func scanKernelPartitions() (*boot.Config, error) {
+	devices, err := probe.Devices()
+	if err != nil {
+		return nil, err
+	}
+
+	slots := []*probe.Device{}
+	for _, dev := range devices {
+		if dev.PartType != gpt.ChromeOSKernel {
+			continue
+		}
+
+		p := kernelSlot(dev)
+		if !p.Bootable() {
+			log.Printf("kpart: %s: skipping slot with priority %d and %d tries left", dev.Path, p.Priority(), p.Tries())
+			continue
+		}
+
+		cmdline, err := boot.ReadKernelCmdline(dev.Path)
+		if err != nil {
+			continue
+		}
+
+		if strings.Contains(cmdline, "sideboot.") {
+			continue
+		}
+
+		slots = append(slots, dev)
+	}
+
+	sort.SliceStable(slots, func(i, j int) bool {
+		return kernelSlot(slots[i]).Priority() > kernelSlot(slots[j]).Priority()
+	})
+
+	cfg := &boot.Config{}
+	for _, dev := range slots {
+		cfg.Entries = append(cfg.Entries, boot.Entry{
+			Name:   "kpart-" + dev.Name,
+			Title:  fmt.Sprintf("ChromeOS kernel %s (%s)", dev.PartLabel, dev.Name),
+			Kernel: dev.Path,
+		})
+	}
+
+	return cfg, nil
+}
+
+func kernelSlot(dev *probe.Device) gpt.Partition {
+	return gpt.Partition{Index: dev.Partition, Type: dev.PartType, Attributes: dev.PartAttributes}
+}
+
+func markTried(device string) {
+	dev, err := probe.Resolve(device)
+	if err != nil || dev.PartType != gpt.ChromeOSKernel {
+		return
+	}
+
+	p, err := gpt.MarkTriedFile(filepath.Join("/dev", dev.Disk), dev.Partition)
+	if err != nil {
+		log.Printf("kpart: %s: %s", dev.Path, err)
+		return
+	}
+
+	if !p.Successful() {
+		log.Printf("kpart: %s: %d tries left", dev.Path, p.Tries())
+	}
+}
+
+func partitionUUID(device string) string {
+	dev, err := probe.Resolve(device)
+	if err != nil {
+		return ""
+	}
+
+	return dev.PartUUID
+}
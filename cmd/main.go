@@ -1,16 +1,21 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
 
+	"sideboot/boot"
+	"sideboot/fdt"
+	"sideboot/kexec"
+	"sideboot/probe"
 	"sideboot/sysinit"
-
-	"github.com/kballard/go-shellquote"
 )
 
 const (
@@ -20,6 +25,16 @@ const (
 	cmdlineOption   = "sideboot.cmdline"
 	partitionOption = "sideboot.partition"
 	configOption    = "sideboot.config"
+	vendorOption    = "sideboot.vendorboot"
+	defaultOption   = "sideboot.default"
+	rootwaitOption  = "sideboot.rootwait"
+	firmwareOption  = "sideboot.firmware"
+	dtbOption       = "sideboot.dtb"
+	dtbdirOption    = "sideboot.dtbdir"
+	overlaysOption  = "sideboot.overlays"
+	initrdOption    = "sideboot.initrdfile"
+	bootJSONOption  = "sideboot.bootjson"
+	preflightOption = "sideboot.preflight"
 )
 
 func resetBootOptions() {
@@ -28,10 +43,26 @@ func resetBootOptions() {
 	sysinit.Args[kernelOption] = ""
 	sysinit.Args[ramdiskOption] = ""
 	sysinit.Args[configOption] = ""
+	sysinit.Args[vendorOption] = ""
+	sysinit.Args[defaultOption] = ""
+	sysinit.Args[rootwaitOption] = "10"
+	sysinit.Args[firmwareOption] = ""
+	sysinit.Args[dtbOption] = ""
+	sysinit.Args[dtbdirOption] = ""
+	sysinit.Args[overlaysOption] = ""
+	sysinit.Args[initrdOption] = ""
+	sysinit.Args[bootJSONOption] = ""
+	sysinit.Args[preflightOption] = "1"
 	sysinit.Args[cmdlineOption] = "console=tty1 loglevel=4"
 }
 
-var bootMsg string
+var (
+	bootMsg  string
+	input    = make(chan string)
+	scanners = []func(string) (*boot.Config, error){
+		boot.ScanBLS, boot.ScanExtlinux, boot.ScanGrub, boot.ScanBootScr, boot.ScanUKI, boot.ScanFIT, boot.ScanAndroid,
+	}
+)
 
 func tryBoot() bool {
 	bootMsg = ""
@@ -42,52 +73,45 @@ func tryBoot() bool {
 	}
 
 	if sysinit.Args[partitionOption] == "" {
-		bootMsg = "no boot partition has been specified"
-		return false
+		return discoverBoot()
 	}
 
-	filename := (sysinit.Exec{"/bin/findfs", sysinit.Args[partitionOption]}).Line(0)
-	if filename == "" {
-		bootMsg = fmt.Sprintf("boot partition %s doesn't point to device", sysinit.Args[partitionOption])
-
+	if !waitPartition(sysinit.Args[partitionOption]) {
+		bootMsg = "user gesture interrupted boot"
 		return false
 	}
 
-	sysinit.Dir{Path: "tmp/boot", Mode: 0x777}.Run()
-	err := sysinit.Mount{Type: "ext2", Flags: syscall.MS_RDONLY, Source: filename, Target: "/tmp/boot"}.Run()
-	defer func() {
-		os.Chdir("/")
-		syscall.Unmount("/tmp/boot", 0)
-	}()
-
+	device, err := mountPartition(sysinit.Args[partitionOption], "/tmp/boot")
 	if err != nil {
-		bootMsg = fmt.Sprintf("error on mount %s: %s", filename, err)
+		bootMsg = err.Error()
 		return false
 	}
 
-	cfg := ""
-	if sysinit.Args[configOption] != "" {
-		cfg = strings.ReplaceAll(sysinit.ReadFile(filepath.Join("/tmp/boot/", sysinit.Args[configOption])), "\n", " ")
-	}
+	firmware := bootFirmwareDirs("/tmp/boot")
 
-	if cfg == "" {
-		cfg = strings.ReplaceAll(sysinit.ReadFile(filepath.Join("/tmp/boot/sideboot.cfg")), "\n", " ")
-	}
+	defer func() {
+		for _, dir := range firmware {
+			sysinit.RemoveFirmwareDir(dir)
+		}
+
+		os.Chdir("/")
+		syscall.Unmount("/tmp/boot", 0)
+	}()
 
-	cfgArgs, err := shellquote.Split(cfg)
+	cfg, err := loadConfig()
 	if err != nil {
-		bootMsg = "commmandline to next kernel contains garbage"
+		bootMsg = fmt.Sprintf("config on %s: %s", sysinit.Args[partitionOption], err)
 		return false
 	}
 
 	if !sysinit.AsInit() {
 		for _, arg := range os.Args[1:] {
-			cfgArgs = append(cfgArgs, "sideboot."+arg)
+			cfg.Options = append(cfg.Options, "sideboot."+arg)
 		}
 	}
 
 	bootPartition := sysinit.Args[partitionOption]
-	sysinit.ParseArgs(cfgArgs)
+	sysinit.ParseArgs(cfg.Options)
 
 	if sysinit.AsInit() && sysinit.Args[shellOption] == "1" {
 		bootMsg = "not booting because default action is set to debug shell"
@@ -102,40 +126,407 @@ func tryBoot() bool {
 
 	os.Chdir("/tmp/boot")
 
-	kexec := sysinit.Exec{"/libexec/kexec", "--command-line", sysinit.Args[cmdlineOption]}
+	configured := boot.Config{Default: cfg.Default, Timeout: cfg.Timeout}
+	cfg.Merge(scanRoot("/tmp/boot", device))
+
+	kparts, err := scanKernelPartitions()
+	if err != nil {
+		log.Print("scan: ", err)
+	} else {
+		cfg.Merge(kparts)
+	}
+
+	if sysinit.Args[kernelOption] != "" {
+		entry := boot.Entry{Name: "sideboot", Kernel: sysinit.Args[kernelOption], Vendor: sysinit.Args[vendorOption]}
+		if sysinit.Args[ramdiskOption] != "" {
+			entry.Ramdisks = strings.Split(sysinit.Args[ramdiskOption], ",")
+		}
+
+		cfg.Entries = append([]boot.Entry{entry}, cfg.Entries...)
+		cfg.Default, cfg.Timeout = configured.Default, configured.Timeout
+		if cfg.Default == "" {
+			cfg.Default = entry.Name
+		}
+	}
+
+	if sysinit.Args[defaultOption] != "" {
+		cfg.Default = sysinit.Args[defaultOption]
+	}
+
+	if len(cfg.Entries) == 0 {
+		bootMsg = fmt.Sprintf("boot requires kernel to be set to existing file on device %s", bootPartition)
+		return false
+	}
+
+	entry, ok := choose(cfg)
+	if !ok {
+		bootMsg = "user gesture interrupted boot"
+		return false
+	}
+
+	if bootEntry(entry, bootPartition) {
+		return true
+	}
+
+	os.Chdir("/")
+	return false
+}
+
+func scanRoot(root string, device string) *boot.Config {
+	pmos := func(root string) (*boot.Config, error) { return scanPostmarketOS(root, device) }
+
+	cfg := &boot.Config{}
+	for _, scan := range append(scanners, pmos) {
+		found, err := scan(root)
+		if err != nil {
+			log.Print("scan: ", err)
+			continue
+		}
+
+		cfg.Merge(found)
+	}
+
+	return cfg
+}
+
+func mountPartition(spec string, target string) (string, error) {
+	failures := []string{}
+	for _, candidate := range strings.Split(spec, ",") {
+		dev, err := probe.Resolve(strings.TrimSpace(candidate))
+		if err == nil {
+			if err = mountDevice(dev, target); err == nil {
+				return dev.Path, nil
+			}
+		}
+
+		log.Print("partition: ", err)
+		failures = append(failures, err.Error())
+	}
+
+	return "", fmt.Errorf("boot partition %s", strings.Join(failures, "; "))
+}
+
+func mountDevice(dev *probe.Device, target string) error {
+	sysinit.Dir{Path: target, Mode: 0x777}.Run()
+	if err := sysinit.MountReadOnly(dev.Path, target, dev.Type); err != nil {
+		return fmt.Errorf("error on mount %w", err)
+	}
+
+	return nil
+}
+
+func resolveImage(path string) string {
+	if path == "" || sysinit.FileExist(path) || !strings.Contains(path, "=") {
+		return path
+	}
+
+	dev, err := probe.Resolve(path)
+	if err != nil {
+		log.Print("probe: ", err)
+		return path
+	}
+
+	return dev.Path
+}
+
+func loadConfig() (*boot.Config, error) {
+	if sysinit.Args[configOption] != "" {
+		cfg, err := boot.ParseFile(filepath.Join("/tmp/boot/", sysinit.Args[configOption]))
+		if err == nil || !os.IsNotExist(err) {
+			return cfg, err
+		}
+
+		log.Print("config: ", err)
+	}
+
+	cfg, err := boot.ParseFile("/tmp/boot/sideboot.cfg")
+	if os.IsNotExist(err) {
+		return &boot.Config{}, nil
+	}
+
+	return cfg, err
+}
+
+func bootEntry(entry boot.Entry, bootPartition string) bool {
+	if entry.Partition != "" && entry.Partition != bootPartition {
+		if _, err := mountPartition(entry.Partition, "/tmp/entry"); err != nil {
+			bootMsg = fmt.Sprintf("entry %s: %s", entry.Label(), err)
+			return false
+		}
+
+		defer func() {
+			os.Chdir("/tmp/boot")
+			syscall.Unmount("/tmp/entry", 0)
+		}()
+
+		os.Chdir("/tmp/entry")
+		bootPartition = entry.Partition
+	}
+
+	if entry.Dtb == "" {
+		entry.Dtb = sysinit.Args[dtbOption]
+	}
+
+	if entry.DtbDir == "" {
+		entry.DtbDir = sysinit.Args[dtbdirOption]
+	}
+
+	if len(entry.Overlays) == 0 && sysinit.Args[overlaysOption] != "" {
+		entry.Overlays = strings.Split(sysinit.Args[overlaysOption], ",")
+	}
 
-	if sysinit.Args[kernelOption] == "" || !sysinit.FileExist(sysinit.Args[kernelOption]) {
+	entry.Kernel = resolveImage(entry.Kernel)
+	if entry.Kernel == "" || !sysinit.FileExist(entry.Kernel) {
 		bootMsg = fmt.Sprintf("boot requires kernel to be set to existing file on device %s", bootPartition)
 		return false
 	}
 
-	if sysinit.Args[ramdiskOption] != "" {
-		if !sysinit.FileExist(sysinit.Args[ramdiskOption]) {
-			bootMsg = fmt.Sprintf("ramdisk is set to non-existing file '%s' on %s", sysinit.Args[ramdiskOption], bootPartition)
+	slot := ""
+	if boot.IsKernelPartition(entry.Kernel) {
+		slot = entry.Kernel
+
+		machine, err := fdt.MachineCompatible()
+		if err != nil {
+			log.Print("kpart: ", err)
+		}
+
+		if entry, err = boot.ExtractKernelPartition(entry, "/tmp/kpart", partitionUUID(entry.Kernel), machine); err != nil {
+			bootMsg = fmt.Sprintf("chromeos kernel partition: %s", err)
+			return false
+		}
+	}
+
+	if boot.IsAndroidBoot(entry.Kernel) {
+		vendor := resolveImage(entry.Vendor)
+		if vendor != "" && !boot.IsAndroidVendorBoot(vendor) {
+			bootMsg = fmt.Sprintf("vendor_boot '%s' is not a vendor_boot image", entry.Vendor)
+			return false
+		}
+
+		if entry.Cmdline == "" {
+			entry.Cmdline = sysinit.Args[cmdlineOption]
+		}
+
+		machine, err := fdt.MachineCompatible()
+		if err != nil {
+			log.Print("android: ", err)
+		}
+
+		if entry, err = boot.ExtractAndroidBoot(entry, "/tmp/android", vendor, machine); err != nil {
+			bootMsg = fmt.Sprintf("android boot image: %s", err)
+			return false
+		}
+	}
+
+	if boot.IsUKI(entry.Kernel) {
+		var err error
+		if entry, err = boot.ExtractUKI(entry, "/tmp/uki"); err != nil {
+			bootMsg = fmt.Sprintf("unified kernel image: %s", err)
+			return false
+		}
+	}
+
+	if boot.IsFIT(entry.Kernel) {
+		machine, err := fdt.MachineCompatible()
+		if err != nil {
+			log.Print("fit: ", err)
+		}
+
+		if entry, err = boot.ExtractFIT(entry, "/tmp/fit", machine); err != nil {
+			bootMsg = fmt.Sprintf("FIT image: %s", err)
+			return false
+		}
+	}
+
+	kernel, image, err := boot.PrepareKernel(entry.Kernel, "/tmp/kernel")
+	if err != nil {
+		bootMsg = fmt.Sprintf("kernel: %s", err)
+		return false
+	}
+
+	log.Printf("kernel: %s is %s", entry.Kernel, image)
+	entry.Kernel = kernel
+
+	cmdline := entry.Cmdline
+	if cmdline == "" {
+		cmdline = sysinit.Args[cmdlineOption]
+	}
+
+	for _, ramdisk := range entry.Ramdisks {
+		if !sysinit.FileExist(ramdisk) {
+			bootMsg = fmt.Sprintf("ramdisk is set to non-existing file '%s' on %s", ramdisk, bootPartition)
+			return false
+		}
+	}
+
+	if entry.Dtb == boot.DtbAuto || entry.Dtb == "" && entry.DtbDir != "" {
+		dtb, err := findDtb(entry)
+		if err != nil && entry.Dtb == boot.DtbAuto {
+			bootMsg = fmt.Sprintf("dtb: %s", err)
+			return false
+		}
+
+		if err != nil {
+			log.Printf("dtb: %s, keeping the running device tree", err)
+		}
+
+		entry.Dtb = dtb
+	}
+
+	if entry.Dtb == boot.DtbRunning || entry.Dtb == "" && len(entry.Overlays) > 0 {
+		entry.Dtb = "/sys/firmware/fdt"
+	}
+
+	if entry.Dtb != "" && !sysinit.FileExist(entry.Dtb) {
+		bootMsg = fmt.Sprintf("dtb is set to non-existing file '%s' on %s", entry.Dtb, bootPartition)
+		return false
+	}
+
+	for _, overlay := range entry.Overlays {
+		if !sysinit.FileExist(overlay) {
+			bootMsg = fmt.Sprintf("overlay is set to non-existing file '%s' on %s", overlay, bootPartition)
+			return false
+		}
+	}
+
+	ramdisk, err := composeInitrd(entry, bootPartition, slot, cmdline)
+	if err != nil {
+		bootMsg = fmt.Sprintf("initrd: %s", err)
+		return false
+	}
+
+	var dtb string
+	if entry.Dtb != "" {
+		chosen := boot.Chosen{
+			Bootargs:   cmdline,
+			Seeds:      true,
+			Properties: map[string]string{"entry": entry.Name, "partition": bootPartition},
+		}
+
+		if dtb, err = boot.PatchDtb(entry.Dtb, entry.Overlays, "/tmp/dtb", chosen); err != nil {
+			bootMsg = fmt.Sprintf("dtb: %s", err)
+			return false
+		}
+	}
+
+	if sysinit.Args[preflightOption] != "0" {
+		preflight := boot.Preflight{Kernel: entry.Kernel, Ramdisk: ramdisk, Dtb: dtb, Cmdline: cmdline}
+		errs, warnings := preflight.Run()
+		for _, err := range warnings {
+			log.Print("preflight: warning: ", err)
+		}
+
+		if len(errs) > 0 {
+			for _, err := range errs {
+				log.Print("preflight: ", err)
+			}
+
+			bootMsg = fmt.Sprintf("preflight failed, boot with sideboot.preflight=0 to skip it:\n%s", errors.Join(errs...))
 			return false
 		}
+	}
+
+	if dtb != "" {
+		err = loadKexecTools(entry.Kernel, ramdisk, dtb, cmdline)
+	} else {
+		err = kexec.Load(entry.Kernel, ramdisk, cmdline)
+	}
+
+	if err != nil {
+		bootMsg = fmt.Sprintf("kernel load: %s", err)
+		return false
+	}
+
+	if slot != "" {
+		markTried(slot)
+	}
+
+	if err := kexec.Exec(); err != nil {
+		bootMsg = fmt.Sprintf("kernel exec: %s", err)
+		return false
+	}
+
+	return true
+}
+
+func findDtb(entry boot.Entry) (string, error) {
+	dirs := boot.DtbDirs(".")
+	if entry.DtbDir != "" {
+		dirs = []string{entry.DtbDir}
+	}
+
+	machine, err := fdt.MachineCompatible()
+	if err != nil {
+		return "", err
+	}
+
+	dtb, reason, err := boot.FindDtb(dirs, machine)
+	if err != nil {
+		return "", err
+	}
 
-		kexec = append(kexec, "--initrd", sysinit.Args[ramdiskOption])
+	log.Printf("dtb: entry %s: using %s (%s)", entry.Label(), dtb, reason)
+	return dtb, nil
+}
+
+func loadKexecTools(kernel string, ramdisk string, dtb string, cmdline string) error {
+	if !sysinit.FileExist("/libexec/kexec") {
+		return fmt.Errorf("passing dtb %s needs kexec-tools at /libexec/kexec", dtb)
+	}
+
+	args := sysinit.Exec{"/libexec/kexec", "--command-line", cmdline, "--dtb", dtb}
+	if ramdisk != "" {
+		args = append(args, "--initrd", ramdisk)
 	}
 
-	kexec = append(kexec, "--load", sysinit.Args[kernelOption])
+	status := append(args, "--load", kernel).Run()
+	if status.Exit != 0 {
+		return fmt.Errorf("kexec-tools failed with status %d: %s", status.Exit, strings.Join(status.Stderr, " "))
+	}
+
+	return nil
+}
 
-	status := kexec.Run()
-	if status.Exit == 0 {
-		status = (sysinit.Exec{"/libexec/kexec", "--exec"}).Run()
-		if status.Exit == 0 {
-			return true
+func choose(cfg *boot.Config) (boot.Entry, bool) {
+	entry, _ := cfg.DefaultEntry()
+	if !sysinit.AsInit() || len(cfg.Entries) < 2 || cfg.Timeout == 0 {
+		return entry, true
+	}
+
+	for i, e := range cfg.Entries {
+		mark := " "
+		if e.Name == entry.Name {
+			mark = "*"
 		}
 
-		bootMsg = "kernel exec"
+		fmt.Printf("%s %d) %s\n", mark, i, e.Label())
+	}
+
+	var timeout <-chan time.Time
+	if cfg.Timeout > 0 {
+		fmt.Printf("booting %s in %d seconds, enter a number to choose another entry\n", entry.Label(), cfg.Timeout)
+		timeout = time.After(time.Duration(cfg.Timeout) * time.Second)
 	} else {
-		bootMsg = "kernel load"
+		fmt.Printf("enter a number to choose an entry, or nothing to boot %s\n", entry.Label())
 	}
 
-	bootMsg = fmt.Sprintf("%s failed with status %d\n", bootMsg, status.Exit)
+	select {
+	case line := <-input:
+		if strings.TrimSpace(line) == "" && timeout == nil {
+			return entry, true
+		}
 
-	os.Chdir("/")
-	return false
+		return cfg.Lookup(strings.TrimSpace(line))
+	case <-timeout:
+		return entry, true
+	}
+}
+
+func readInput() {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		input <- scanner.Text()
+	}
 }
 
 func wait() bool {
@@ -143,16 +534,12 @@ func wait() bool {
 		return true
 	}
 
-	ch := make(chan bool)
-	go func() {
-		time.Sleep(time.Second)
-		ch <- true
-	}()
-	go func() {
-		fmt.Scanln()
-		ch <- false
-	}()
-	return <-ch
+	select {
+	case <-input:
+		return false
+	case <-time.After(time.Second):
+		return true
+	}
 }
 
 func main() {
@@ -171,6 +558,11 @@ _/_/_/    _/    _/_/_/    _/_/_/  _/_/_/      _/_/      _/_/        _/_/
 	}
 
 	defer sysinit.Exit()
+	if sysinit.AsInit() {
+		go readInput()
+		mountFirmwarePartitions()
+	}
+
 	if tryBoot() {
 		return
 	}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"sideboot/boot"
+	"sideboot/probe"
+)
+
+func scanPostmarketOS(root string, device string) (*boot.Config, error) {
+	devices, _ := probe.Devices()
+	bootDev := findDevice(devices, func(d *probe.Device) bool { return d.Path == device })
+
+	info, err := boot.FindDeviceInfo(root)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if info == nil && bootDev.Label != "pmOS_boot" && !boot.IsPostmarketOS(root) {
+		return &boot.Config{}, nil
+	}
+
+	rootDev := pmosRootDevice(devices, bootDev)
+	if info == nil && rootDev.Path != "" {
+		info = rootDeviceInfo(&rootDev)
+	}
+
+	entry, err := boot.PostmarketOSEntry(root, info, bootDev.UUID, rootDev.UUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &boot.Config{Entries: []boot.Entry{entry}}, nil
+}
+
+func findDevice(devices []*probe.Device, match func(*probe.Device) bool) probe.Device {
+	for _, dev := range devices {
+		if match(dev) {
+			return *dev
+		}
+	}
+
+	return probe.Device{}
+}
+
+func pmosRootDevice(devices []*probe.Device, bootDev probe.Device) probe.Device {
+	if dev := findDevice(devices, func(d *probe.Device) bool { return d.Label == "pmOS_root" }); dev.Path != "" {
+		return dev
+	}
+
+	if !bootDev.IsPartition() {
+		return probe.Device{}
+	}
+
+	return findDevice(devices, func(d *probe.Device) bool { return d.Disk == bootDev.Disk && d.Partition == bootDev.Partition+1 })
+}
+
+func rootDeviceInfo(dev *probe.Device) map[string]string {
+	if err := mountDevice(dev, "/tmp/root"); err != nil {
+		return nil
+	}
+	defer syscall.Unmount("/tmp/root", 0)
+
+	info, _ := boot.FindDeviceInfo("/tmp/root")
+	return info
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"sideboot/probe"
+)
+
+func TestPmosRootDevice(t *testing.T) {
+	emmc := []*probe.Device{
+		{Name: "mmcblk0", Path: "/dev/mmcblk0"},
+		{Name: "mmcblk0p1", Path: "/dev/mmcblk0p1", Disk: "mmcblk0", Partition: 1, Filesystem: probe.Filesystem{Type: "ext2", Label: "pmOS_boot"}},
+		{Name: "mmcblk0p2", Path: "/dev/mmcblk0p2", Disk: "mmcblk0", Partition: 2, Filesystem: probe.Filesystem{Type: "ext4", UUID: "root"}},
+		{Name: "mmcblk1p2", Path: "/dev/mmcblk1p2", Disk: "mmcblk1", Partition: 2, Filesystem: probe.Filesystem{Type: "ext4", UUID: "sdcard"}},
+		{Name: "nvme0n1p3", Path: "/dev/nvme0n1p3", Disk: "nvme0n1", Partition: 3, Filesystem: probe.Filesystem{Type: "ext4", UUID: "nvme"}},
+	}
+
+	tests := []struct {
+		boot string
+		want string
+	}{
+		{"/dev/mmcblk0p1", "/dev/mmcblk0p2"},
+		{"/dev/mmcblk0p2", ""},
+		{"/dev/mmcblk1p1", ""},
+		{"/dev/mmcblk0", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		bootDev := findDevice(emmc, func(d *probe.Device) bool { return d.Path == test.boot })
+		if got := pmosRootDevice(emmc, bootDev); got.Path != test.want {
+			t.Errorf("%s: got %q, want %q", test.boot, got.Path, test.want)
+		}
+	}
+
+	labelled := append(emmc, &probe.Device{Name: "sda2", Path: "/dev/sda2", Disk: "sda", Partition: 2, Filesystem: probe.Filesystem{Type: "ext4", Label: "pmOS_root"}})
+	if got := pmosRootDevice(labelled, *emmc[1]); got.Path != "/dev/sda2" {
+		t.Errorf("pmOS_root label: got %q", got.Path)
+	}
+}
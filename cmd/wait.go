@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"sideboot/probe"
+	"sideboot/sysinit"
+)
+
+func rootwait() time.Duration {
+	switch value := sysinit.Args[rootwaitOption]; value {
+	case "", "0":
+		return 0
+	case rootwaitOption:
+		return -1
+	default:
+		seconds, err := strconv.Atoi(value)
+		if err != nil {
+			log.Printf("rootwait: invalid timeout %s", value)
+			return 0
+		}
+
+		return time.Duration(seconds) * time.Second
+	}
+}
+
+func partitionPresent(spec string) bool {
+	for _, candidate := range strings.Split(spec, ",") {
+		_, err := probe.Resolve(strings.TrimSpace(candidate))
+		if !errors.Is(err, probe.ErrNotFound) && !errors.Is(err, probe.ErrUnreadable) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func waitPartition(spec string) bool {
+	timeout := rootwait()
+	if timeout == 0 || partitionPresent(spec) {
+		return true
+	}
+
+	events, unsubscribe := sysinit.SubscribeUevents()
+	defer unsubscribe()
+
+	var poll <-chan time.Time
+	if !sysinit.UeventsStarted() {
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	progress := time.NewTicker(time.Second)
+	defer progress.Stop()
+
+	start := time.Now()
+	fmt.Printf("waiting for %s", spec)
+	defer fmt.Println()
+
+	for {
+		select {
+		case <-input:
+			return false
+		case event := <-events:
+			if event.Subsystem != "block" || event.Action != "add" && event.Action != "change" {
+				continue
+			}
+		case <-poll:
+		case <-progress.C:
+			fmt.Print(".")
+			if timeout > 0 && time.Since(start) >= timeout {
+				fmt.Printf(" gave up after %s", timeout)
+				return true
+			}
+
+			continue
+		}
+
+		if partitionPresent(spec) {
+			fmt.Printf(" found after %s", time.Since(start).Round(time.Millisecond))
+			return true
+		}
+	}
+}
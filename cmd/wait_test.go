@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"sideboot/sysinit"
+)
+
+func TestRootwait(t *testing.T) {
+	defer delete(sysinit.Args, rootwaitOption)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"10", 10 * time.Second},
+		{rootwaitOption, -1},
+		{"forever", 0},
+	}
+
+	for _, test := range tests {
+		sysinit.Args[rootwaitOption] = test.value
+		if got := rootwait(); got != test.want {
+			t.Errorf("%q: got %s, want %s", test.value, got, test.want)
+		}
+	}
+
+	sysinit.Args[rootwaitOption] = "0"
+	if !waitPartition("PARTUUID=00000000-0000-0000-0000-000000000000") {
+		t.Error("rootwait disabled: waitPartition returned false")
+	}
+}
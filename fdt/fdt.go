@@ -0,0 +1,345 @@
+package fdt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	Magic = 0xd00dfeed
+
+	tokenBeginNode = 1
+	tokenEndNode   = 2
+	tokenProp      = 3
+	tokenNop       = 4
+	tokenEnd       = 9
+
+	headerSize = 40
+	maxDepth   = 64
+)
+
+var ErrBadMagic = errors.New("not a flattened device tree")
+
+type Property struct {
+	Name  string
+	Value []byte
+}
+
+type Node struct {
+	Name       string
+	Properties []Property
+	Children   []*Node
+}
+
+type Reservation struct {
+	Address uint64
+	Size    uint64
+}
+
+type Tree struct {
+	Root         *Node
+	BootCPU      uint32
+	Reservations []Reservation
+	Size         int
+}
+
+func IsFDT(data []byte) bool {
+	return len(data) >= 4 && binary.BigEndian.Uint32(data) == Magic
+}
+
+func Load(path string) (*Tree, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return tree, nil
+}
+
+func Parse(data []byte) (*Tree, error) {
+	if len(data) < headerSize || !IsFDT(data) {
+		return nil, ErrBadMagic
+	}
+
+	be := binary.BigEndian
+	total := uint64(be.Uint32(data[4:]))
+	structOff, stringsOff, reserveOff := uint64(be.Uint32(data[8:])), uint64(be.Uint32(data[12:])), uint64(be.Uint32(data[16:]))
+	version := be.Uint32(data[20:])
+	stringsSize, structSize := uint64(be.Uint32(data[32:])), uint64(be.Uint32(data[36:]))
+
+	if version < 16 {
+		return nil, fmt.Errorf("device tree version %d is too old", version)
+	}
+
+	if total > uint64(len(data)) || structOff > total || structSize > total-structOff ||
+		stringsOff > total || stringsSize > total-stringsOff || reserveOff > total {
+		return nil, errors.New("device tree header points outside of the blob")
+	}
+
+	tree := &Tree{BootCPU: be.Uint32(data[28:]), Size: int(total)}
+	data = data[:total]
+
+	for off := reserveOff; off+16 <= total; off += 16 {
+		address, size := be.Uint64(data[off:]), be.Uint64(data[off+8:])
+		if address == 0 && size == 0 {
+			break
+		}
+
+		tree.Reservations = append(tree.Reservations, Reservation{Address: address, Size: size})
+	}
+
+	p := &parser{
+		data:    data[structOff : structOff+structSize],
+		strings: data[stringsOff : stringsOff+stringsSize],
+	}
+
+	root, err := p.node()
+	if err != nil {
+		return nil, err
+	}
+
+	tree.Root = root
+	return tree, nil
+}
+
+type parser struct {
+	data    []byte
+	strings []byte
+	off     int
+	depth   int
+}
+
+func (p *parser) token() (uint32, error) {
+	for {
+		if p.off+4 > len(p.data) {
+			return 0, errors.New("device tree structure is truncated")
+		}
+
+		token := binary.BigEndian.Uint32(p.data[p.off:])
+		p.off += 4
+		if token != tokenNop {
+			return token, nil
+		}
+	}
+}
+
+func (p *parser) cstring(data []byte, off int) (string, int, error) {
+	if off < 0 || off > len(data) {
+		return "", 0, errors.New("device tree string is out of bounds")
+	}
+
+	end := bytes.IndexByte(data[off:], 0)
+	if end < 0 {
+		return "", 0, errors.New("device tree string is not terminated")
+	}
+
+	return string(data[off : off+end]), off + end + 1, nil
+}
+
+func (p *parser) node() (*Node, error) {
+	token, err := p.token()
+	if err != nil {
+		return nil, err
+	}
+
+	if token != tokenBeginNode {
+		return nil, fmt.Errorf("unexpected device tree token %d", token)
+	}
+
+	node := &Node{}
+	if node.Name, p.off, err = p.cstring(p.data, p.off); err != nil {
+		return nil, err
+	}
+
+	p.off = align(p.off)
+
+	for {
+		token, err := p.token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch token {
+		case tokenProp:
+			if p.off+8 > len(p.data) {
+				return nil, errors.New("device tree property is truncated")
+			}
+
+			size := uint64(binary.BigEndian.Uint32(p.data[p.off:]))
+			nameOff := uint64(binary.BigEndian.Uint32(p.data[p.off+4:]))
+			p.off += 8
+
+			if size > uint64(len(p.data)-p.off) {
+				return nil, errors.New("device tree property value is truncated")
+			}
+
+			name, _, err := p.cstring(p.strings, int(nameOff))
+			if err != nil {
+				return nil, err
+			}
+
+			end := p.off + int(size)
+			node.Properties = append(node.Properties, Property{Name: name, Value: p.data[p.off:end]})
+			p.off = align(end)
+		case tokenBeginNode:
+			if p.depth++; p.depth > maxDepth {
+				return nil, errors.New("device tree is nested too deeply")
+			}
+
+			p.off -= 4
+			child, err := p.node()
+			p.depth--
+			if err != nil {
+				return nil, err
+			}
+
+			node.Children = append(node.Children, child)
+		case tokenEndNode:
+			return node, nil
+		case tokenEnd:
+			return nil, errors.New("device tree ends inside a node")
+		default:
+			return nil, fmt.Errorf("unexpected device tree token %d", token)
+		}
+	}
+}
+
+func align(off int) int {
+	return (off + 3) &^ 3
+}
+
+func (n *Node) Child(name string) *Node {
+	for _, child := range n.Children {
+		if child.Name == name {
+			return child
+		}
+	}
+
+	for _, child := range n.Children {
+		if base, _, _ := strings.Cut(child.Name, "@"); base == name {
+			return child
+		}
+	}
+
+	return nil
+}
+
+func (n *Node) Property(name string) ([]byte, bool) {
+	for _, prop := range n.Properties {
+		if prop.Name == name {
+			return prop.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+func (n *Node) String(name string) string {
+	value, _ := n.Property(name)
+	return string(bytes.TrimRight(value, "\x00"))
+}
+
+func (n *Node) Strings(name string) []string {
+	value, ok := n.Property(name)
+	if !ok {
+		return nil
+	}
+
+	return SplitStrings(value)
+}
+
+func (n *Node) Uint32(name string) (uint32, bool) {
+	value, ok := n.Property(name)
+	if !ok || len(value) != 4 {
+		return 0, false
+	}
+
+	return binary.BigEndian.Uint32(value), true
+}
+
+func (n *Node) Uint64(name string) (uint64, bool) {
+	value, ok := n.Property(name)
+	switch {
+	case ok && len(value) == 4:
+		return uint64(binary.BigEndian.Uint32(value)), true
+	case ok && len(value) == 8:
+		return binary.BigEndian.Uint64(value), true
+	}
+
+	return 0, false
+}
+
+func (t *Tree) Lookup(path string) *Node {
+	node := t.Root
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		if name == "" {
+			continue
+		}
+
+		if node = node.Child(name); node == nil {
+			return nil
+		}
+	}
+
+	return node
+}
+
+func SplitStrings(value []byte) []string {
+	value = bytes.TrimRight(value, "\x00")
+	if len(value) == 0 {
+		return nil
+	}
+
+	return strings.Split(string(value), "\x00")
+}
+
+func Score(compatible []string, machine []string) int {
+	for i, want := range machine {
+		for _, have := range compatible {
+			if have == want {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+func SplitBlobs(data []byte) [][]byte {
+	blobs := [][]byte{}
+	for len(data) >= headerSize && IsFDT(data) {
+		size := int(binary.BigEndian.Uint32(data[4:]))
+		if size < headerSize || size > len(data) {
+			break
+		}
+
+		blobs = append(blobs, data[:size])
+		data = data[size:]
+	}
+
+	return blobs
+}
+
+func MachineCompatible() ([]string, error) {
+	for _, path := range []string{"/proc/device-tree/compatible", "/sys/firmware/devicetree/base/compatible"} {
+		if data, err := os.ReadFile(path); err == nil {
+			return SplitStrings(data), nil
+		}
+	}
+
+	tree, err := Load("/sys/firmware/fdt")
+	if err != nil {
+		return nil, err
+	}
+
+	return tree.Root.Strings("compatible"), nil
+}
@@ -0,0 +1,108 @@
+package fdt
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+func testBlob(t *testing.T) []byte {
+	data, err := os.ReadFile("../kernel/dtbs/qcom/sc7180-trogdor-lazor-r3.dtb")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	return data
+}
+
+func TestParse(t *testing.T) {
+	tree, err := Parse(testBlob(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := tree.Root.Strings("compatible"); len(got) == 0 || got[0] != "google,lazor-rev3" {
+		t.Errorf("compatible = %q", got)
+	}
+
+	if tree.Lookup("/chosen") == nil {
+		t.Error("/chosen not found")
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	valid := testBlob(t)
+	total := uint32(len(valid))
+
+	tests := []struct {
+		name  string
+		off   int
+		value uint32
+	}{
+		{"totalsize too large", 4, total + 1},
+		{"struct offset wraps", 8, 0xfffffff0},
+		{"struct size wraps", 36, 0xfffffff0},
+		{"struct offset past end", 8, total + 8},
+		{"strings offset wraps", 12, 0xfffffff0},
+		{"strings size wraps", 32, 0xfffffff0},
+		{"strings past end", 12, total - 4},
+		{"reserve map past end", 16, total + 16},
+		{"reserve map wraps", 16, 0xfffffff8},
+		{"old version", 20, 15},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := append([]byte{}, valid...)
+			binary.BigEndian.PutUint32(data[test.off:], test.value)
+			if _, err := Parse(data); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	valid := testBlob(t)
+	for _, n := range []int{0, 4, headerSize - 1, headerSize, 100, len(valid) / 2, len(valid) - 1} {
+		if _, err := Parse(valid[:n]); err == nil {
+			t.Errorf("%d bytes: expected an error", n)
+		}
+	}
+}
+
+func TestParseCorruptStructure(t *testing.T) {
+	valid := testBlob(t)
+	structOff := binary.BigEndian.Uint32(valid[8:])
+	structSize := binary.BigEndian.Uint32(valid[36:])
+
+	for off := structOff; off < structOff+min(structSize, 1024); off += 4 {
+		for _, value := range []uint32{0, tokenBeginNode, tokenProp, tokenEnd, 0x7fffffff, 0xffffffff} {
+			data := append([]byte{}, valid...)
+			binary.BigEndian.PutUint32(data[off:], value)
+			Parse(data)
+		}
+	}
+}
+
+func TestParseDeepNesting(t *testing.T) {
+	structure := []byte{}
+	for range 10000 {
+		structure = binary.BigEndian.AppendUint32(structure, tokenBeginNode)
+		structure = append(structure, 'n', 0, 0, 0)
+	}
+
+	data := make([]byte, headerSize)
+	binary.BigEndian.PutUint32(data[0:], Magic)
+	binary.BigEndian.PutUint32(data[4:], uint32(headerSize+len(structure)))
+	binary.BigEndian.PutUint32(data[8:], headerSize)
+	binary.BigEndian.PutUint32(data[12:], uint32(headerSize+len(structure)))
+	binary.BigEndian.PutUint32(data[16:], uint32(headerSize+len(structure)))
+	binary.BigEndian.PutUint32(data[20:], 17)
+	binary.BigEndian.PutUint32(data[36:], uint32(len(structure)))
+	data = append(data, structure...)
+
+	if _, err := Parse(data); err == nil {
+		t.Error("expected an error")
+	}
+}
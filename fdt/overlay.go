@@ -0,0 +1,245 @@
+package fdt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func (n *Node) Phandle() (uint32, bool) {
+	if phandle, ok := n.Uint32("phandle"); ok {
+		return phandle, true
+	}
+
+	return n.Uint32("linux,phandle")
+}
+
+func (t *Tree) phandles() (map[uint32]string, uint32) {
+	paths, max := map[uint32]string{}, uint32(0)
+
+	var walk func(n *Node, path string)
+	walk = func(n *Node, path string) {
+		if phandle, ok := n.Phandle(); ok {
+			paths[phandle] = path
+			if phandle > max && phandle != 0xffffffff {
+				max = phandle
+			}
+		}
+
+		for _, child := range n.Children {
+			walk(child, strings.TrimSuffix(path, "/")+"/"+child.Name)
+		}
+	}
+
+	walk(t.Root, "/")
+	return paths, max
+}
+
+func (t *Tree) ApplyOverlay(overlay *Tree) error {
+	paths, delta := t.phandles()
+
+	adjustPhandles(overlay.Root, delta)
+
+	if fixups := overlay.Root.Child("__local_fixups__"); fixups != nil {
+		if err := applyLocalFixups(overlay.Root, fixups, delta, ""); err != nil {
+			return err
+		}
+	}
+
+	if fixups := overlay.Root.Child("__fixups__"); fixups != nil {
+		if err := t.applyFixups(overlay, fixups, paths); err != nil {
+			return err
+		}
+	}
+
+	targets := map[string]string{}
+	for _, fragment := range overlay.Root.Children {
+		content := fragment.Child("__overlay__")
+		if content == nil || fragment.Name == "__symbols__" {
+			continue
+		}
+
+		path, err := t.fragmentTarget(fragment, paths)
+		if err != nil {
+			return fmt.Errorf("fragment %s: %w", fragment.Name, err)
+		}
+
+		target := t.Lookup(path)
+		if target == nil {
+			return fmt.Errorf("fragment %s: target node %s not found", fragment.Name, path)
+		}
+
+		merge(target, content)
+		targets["/"+fragment.Name+"/__overlay__"] = path
+	}
+
+	if symbols := overlay.Root.Child("__symbols__"); symbols != nil {
+		t.mergeSymbols(symbols, targets)
+	}
+
+	return nil
+}
+
+func adjustPhandles(n *Node, delta uint32) {
+	for i, prop := range n.Properties {
+		if (prop.Name == "phandle" || prop.Name == "linux,phandle") && len(prop.Value) == 4 {
+			n.Properties[i].Value = binary.BigEndian.AppendUint32(nil, binary.BigEndian.Uint32(prop.Value)+delta)
+		}
+	}
+
+	for _, child := range n.Children {
+		adjustPhandles(child, delta)
+	}
+}
+
+func applyLocalFixups(n *Node, fixups *Node, delta uint32, path string) error {
+	for _, fixup := range fixups.Properties {
+		value, ok := n.Property(fixup.Name)
+		if !ok {
+			return fmt.Errorf("local fixup %s/%s: property not found", path, fixup.Name)
+		}
+
+		value = append([]byte{}, value...)
+		for off := 0; off+4 <= len(fixup.Value); off += 4 {
+			at := binary.BigEndian.Uint32(fixup.Value[off:])
+			if uint64(at)+4 > uint64(len(value)) {
+				return fmt.Errorf("local fixup %s/%s: offset %d is out of range", path, fixup.Name, at)
+			}
+
+			binary.BigEndian.PutUint32(value[at:], binary.BigEndian.Uint32(value[at:])+delta)
+		}
+
+		n.SetProperty(fixup.Name, value)
+	}
+
+	for _, child := range fixups.Children {
+		node := n.Child(child.Name)
+		if node == nil {
+			return fmt.Errorf("local fixup %s/%s: node not found", path, child.Name)
+		}
+
+		if err := applyLocalFixups(node, child, delta, path+"/"+child.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *Tree) applyFixups(overlay *Tree, fixups *Node, paths map[uint32]string) error {
+	symbols := t.Lookup("/__symbols__")
+	for _, fixup := range fixups.Properties {
+		if symbols == nil {
+			return fmt.Errorf("label %s can't be resolved, base device tree has no __symbols__ (build it with dtc -@)", fixup.Name)
+		}
+
+		path := symbols.String(fixup.Name)
+		if path == "" {
+			return fmt.Errorf("label %s not found in base __symbols__", fixup.Name)
+		}
+
+		target := t.Lookup(path)
+		if target == nil {
+			return fmt.Errorf("label %s points to missing node %s", fixup.Name, path)
+		}
+
+		phandle, ok := target.Phandle()
+		if !ok {
+			_, max := overlay.phandles()
+			if _, base := t.phandles(); base > max {
+				max = base
+			}
+
+			phandle = max + 1
+			target.SetUint32("phandle", phandle)
+			paths[phandle] = path
+		}
+
+		for _, ref := range SplitStrings(fixup.Value) {
+			if err := setReference(overlay, ref, phandle); err != nil {
+				return fmt.Errorf("label %s: %w", fixup.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func setReference(overlay *Tree, ref string, phandle uint32) error {
+	parts := strings.Split(ref, ":")
+	if len(parts) != 3 {
+		return fmt.Errorf("fixup %s is malformed", ref)
+	}
+
+	off, err := strconv.Atoi(parts[2])
+	if err != nil || off < 0 {
+		return fmt.Errorf("fixup %s is malformed", ref)
+	}
+
+	node := overlay.Lookup(parts[0])
+	if node == nil {
+		return fmt.Errorf("fixup %s: node %s not found", ref, parts[0])
+	}
+
+	value, ok := node.Property(parts[1])
+	if !ok || off+4 > len(value) {
+		return fmt.Errorf("fixup %s: property %s is missing or too short", ref, parts[1])
+	}
+
+	value = append([]byte{}, value...)
+	binary.BigEndian.PutUint32(value[off:], phandle)
+	node.SetProperty(parts[1], value)
+	return nil
+}
+
+func (t *Tree) fragmentTarget(fragment *Node, paths map[uint32]string) (string, error) {
+	if phandle, ok := fragment.Uint32("target"); ok {
+		path, ok := paths[phandle]
+		if !ok {
+			return "", fmt.Errorf("target phandle %#x not found", phandle)
+		}
+
+		return path, nil
+	}
+
+	if path := fragment.String("target-path"); path != "" {
+		if !strings.HasPrefix(path, "/") {
+			if symbols := t.Lookup("/__symbols__"); symbols != nil && symbols.String(path) != "" {
+				return symbols.String(path), nil
+			}
+
+			return "", fmt.Errorf("target alias %s not found", path)
+		}
+
+		return path, nil
+	}
+
+	return "", errors.New("fragment has neither target nor target-path")
+}
+
+func merge(target *Node, content *Node) {
+	for _, prop := range content.Properties {
+		target.SetProperty(prop.Name, prop.Value)
+	}
+
+	for _, child := range content.Children {
+		node := target.AddChild(child.Name)
+		merge(node, child)
+	}
+}
+
+func (t *Tree) mergeSymbols(symbols *Node, targets map[string]string) {
+	base := t.Create("/__symbols__")
+	for _, prop := range symbols.Properties {
+		path := strings.TrimRight(string(prop.Value), "\x00")
+		for prefix, target := range targets {
+			if path == prefix || strings.HasPrefix(path, prefix+"/") {
+				path = strings.TrimSuffix(target, "/") + strings.TrimPrefix(path, prefix)
+				base.SetString(prop.Name, path)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package fdt
+
+import (
+	"strings"
+	"testing"
+)
+
+func testBase() *Tree {
+	tree := &Tree{Root: &Node{}}
+	tree.Create("/soc/serial@1000").SetUint32("phandle", 1)
+	tree.Create("/soc/i2c@2000").SetUint32("phandle", 5)
+	tree.Create("/soc/spi@3000")
+	tree.Create("/chosen")
+
+	symbols := tree.Create("/__symbols__")
+	symbols.SetString("serial0", "/soc/serial@1000")
+	symbols.SetString("spi0", "/soc/spi@3000")
+	return tree
+}
+
+func testOverlay(label string, fixup string) *Tree {
+	tree := &Tree{Root: &Node{}}
+	fragment := tree.Create("/fragment@0")
+	fragment.SetUint32("target", 0xffffffff)
+
+	content := tree.Create("/fragment@0/__overlay__")
+	content.SetString("status", "okay")
+
+	bt := tree.Create("/fragment@0/__overlay__/bt")
+	bt.SetUint32("phandle", 1)
+	bt.SetUint32("self", 1)
+	bt.SetUint32("uart", 0xffffffff)
+
+	tree.Create("/fragment@1").SetString("target-path", "/chosen")
+	tree.Create("/fragment@1/__overlay__").SetString("overlay", "applied")
+
+	tree.Create("/__fixups__").SetStrings(label, []string{"/fragment@0:target:0", fixup})
+	tree.Create("/__local_fixups__/fragment@0/__overlay__/bt").SetUint32("self", 0)
+	tree.Create("/__symbols__").SetString("bt", "/fragment@0/__overlay__/bt")
+	return tree
+}
+
+func TestApplyOverlay(t *testing.T) {
+	base := testBase()
+	if err := base.ApplyOverlay(testOverlay("serial0", "/fragment@0/__overlay__/bt:uart:0")); err != nil {
+		t.Fatal(err)
+	}
+
+	serial := base.Lookup("/soc/serial@1000")
+	if serial.String("status") != "okay" {
+		t.Errorf("status = %q", serial.String("status"))
+	}
+
+	bt := base.Lookup("/soc/serial@1000/bt")
+	if bt == nil {
+		t.Fatal("overlay node not merged")
+	}
+
+	phandle, _ := bt.Phandle()
+	self, _ := bt.Uint32("self")
+	uart, _ := bt.Uint32("uart")
+	if phandle != 6 || self != 6 || uart != 1 {
+		t.Errorf("phandle = %d, self = %d, uart = %d", phandle, self, uart)
+	}
+
+	if got := base.Lookup("/chosen").String("overlay"); got != "applied" {
+		t.Errorf("target-path fragment: %q", got)
+	}
+
+	if got := base.Lookup("/__symbols__").String("bt"); got != "/soc/serial@1000/bt" {
+		t.Errorf("symbol bt = %q", got)
+	}
+
+	if _, err := Parse(base.Bytes()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyOverlayNewPhandle(t *testing.T) {
+	base := testBase()
+	if err := base.ApplyOverlay(testOverlay("spi0", "/fragment@0/__overlay__/bt:uart:0")); err != nil {
+		t.Fatal(err)
+	}
+
+	spi, _ := base.Lookup("/soc/spi@3000").Phandle()
+	bt, _ := base.Lookup("/soc/spi@3000/bt").Phandle()
+	uart, _ := base.Lookup("/soc/spi@3000/bt").Uint32("uart")
+	if spi != 7 || bt != 6 || uart != spi {
+		t.Errorf("spi = %d, bt = %d, uart = %d", spi, bt, uart)
+	}
+}
+
+func TestApplyOverlayErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    func(*Tree)
+		overlay func(*Tree)
+		err     string
+	}{
+		{"unknown label", nil, func(o *Tree) {
+			o.Create("/__fixups__").SetStrings("uart9", []string{"/fragment@0:target:0"})
+		}, "not found in base __symbols__"},
+		{"no symbols", func(b *Tree) { b.Root.DeleteChild("__symbols__") }, nil, "dtc -@"},
+		{"dangling label", func(b *Tree) { b.Lookup("/__symbols__").SetString("serial0", "/soc/missing") }, nil, "missing node"},
+		{"malformed fixup", nil, func(o *Tree) {
+			o.Create("/__fixups__").SetStrings("serial0", []string{"/fragment@0:target"})
+		}, "malformed"},
+		{"negative fixup offset", nil, func(o *Tree) {
+			o.Create("/__fixups__").SetStrings("serial0", []string{"/fragment@0:target:-4"})
+		}, "malformed"},
+		{"fixup past property", nil, func(o *Tree) {
+			o.Create("/__fixups__").SetStrings("serial0", []string{"/fragment@0:target:4"})
+		}, "too short"},
+		{"local fixup past property", nil, func(o *Tree) {
+			o.Create("/__local_fixups__/fragment@0/__overlay__/bt").SetUint32("self", 2)
+		}, "out of range"},
+		{"huge local fixup offset", nil, func(o *Tree) {
+			o.Create("/__local_fixups__/fragment@0/__overlay__/bt").SetUint32("self", 0xffffffff)
+		}, "out of range"},
+		{"missing target path", nil, func(o *Tree) {
+			o.Create("/fragment@1").SetString("target-path", "/missing")
+		}, "not found"},
+		{"unknown alias", nil, func(o *Tree) {
+			o.Create("/fragment@1").SetString("target-path", "uart9")
+		}, "alias"},
+		{"no target", nil, func(o *Tree) {
+			o.Create("/fragment@1").DeleteProperty("target-path")
+		}, "neither target"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			base, overlay := testBase(), testOverlay("serial0", "/fragment@0/__overlay__/bt:uart:0")
+			if test.base != nil {
+				test.base(base)
+			}
+
+			if test.overlay != nil {
+				test.overlay(overlay)
+			}
+
+			err := base.ApplyOverlay(overlay)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestApplyOverlayTargetPhandle(t *testing.T) {
+	base := testBase()
+	overlay := &Tree{Root: &Node{}}
+	overlay.Create("/fragment@0").SetUint32("target", 5)
+	overlay.Create("/fragment@0/__overlay__").SetString("status", "disabled")
+
+	if err := base.ApplyOverlay(overlay); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := base.Lookup("/soc/i2c").String("status"); got != "disabled" {
+		t.Errorf("status = %q", got)
+	}
+
+	overlay.Create("/fragment@0").SetUint32("target", 42)
+	if err := testBase().ApplyOverlay(overlay); err == nil {
+		t.Error("expected an error for an unknown target phandle")
+	}
+}
@@ -0,0 +1,194 @@
+package fdt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	writeVersion  = 17
+	compatVersion = 16
+)
+
+func Running() (*Tree, error) {
+	return Load("/sys/firmware/fdt")
+}
+
+func (n *Node) SetProperty(name string, value []byte) {
+	for i, prop := range n.Properties {
+		if prop.Name == name {
+			n.Properties[i].Value = value
+			return
+		}
+	}
+
+	n.Properties = append(n.Properties, Property{Name: name, Value: value})
+}
+
+func (n *Node) SetString(name string, value string) {
+	n.SetProperty(name, append([]byte(value), 0))
+}
+
+func (n *Node) SetStrings(name string, values []string) {
+	value := []byte{}
+	for _, s := range values {
+		value = append(append(value, s...), 0)
+	}
+
+	n.SetProperty(name, value)
+}
+
+func (n *Node) SetUint32(name string, value uint32) {
+	n.SetProperty(name, binary.BigEndian.AppendUint32(nil, value))
+}
+
+func (n *Node) SetUint64(name string, value uint64) {
+	n.SetProperty(name, binary.BigEndian.AppendUint64(nil, value))
+}
+
+func (n *Node) DeleteProperty(name string) bool {
+	for i, prop := range n.Properties {
+		if prop.Name == name {
+			n.Properties = append(n.Properties[:i], n.Properties[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (n *Node) AddChild(name string) *Node {
+	for _, child := range n.Children {
+		if child.Name == name {
+			return child
+		}
+	}
+
+	child := &Node{Name: name}
+	n.Children = append(n.Children, child)
+	return child
+}
+
+func (n *Node) DeleteChild(name string) bool {
+	for i, child := range n.Children {
+		if child.Name == name {
+			n.Children = append(n.Children[:i], n.Children[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *Tree) Create(path string) *Node {
+	node := t.Root
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		if name == "" {
+			continue
+		}
+
+		if child := node.Child(name); child != nil {
+			node = child
+		} else {
+			node = node.AddChild(name)
+		}
+	}
+
+	return node
+}
+
+type writer struct {
+	structure bytes.Buffer
+	strings   bytes.Buffer
+	offsets   map[string]uint32
+}
+
+func (w *writer) token(token uint32) {
+	binary.Write(&w.structure, binary.BigEndian, token)
+}
+
+func (w *writer) pad() {
+	for w.structure.Len()%4 != 0 {
+		w.structure.WriteByte(0)
+	}
+}
+
+func (w *writer) name(name string) uint32 {
+	if off, ok := w.offsets[name]; ok {
+		return off
+	}
+
+	off := uint32(w.strings.Len())
+	w.strings.WriteString(name)
+	w.strings.WriteByte(0)
+	w.offsets[name] = off
+	return off
+}
+
+func (w *writer) node(n *Node) {
+	w.token(tokenBeginNode)
+	w.structure.WriteString(n.Name)
+	w.structure.WriteByte(0)
+	w.pad()
+
+	for _, prop := range n.Properties {
+		w.token(tokenProp)
+		w.token(uint32(len(prop.Value)))
+		w.token(w.name(prop.Name))
+		w.structure.Write(prop.Value)
+		w.pad()
+	}
+
+	for _, child := range n.Children {
+		w.node(child)
+	}
+
+	w.token(tokenEndNode)
+}
+
+func (t *Tree) Bytes() []byte {
+	w := &writer{offsets: map[string]uint32{}}
+	w.node(t.Root)
+	w.token(tokenEnd)
+
+	reserve := &bytes.Buffer{}
+	for _, r := range t.Reservations {
+		binary.Write(reserve, binary.BigEndian, r.Address)
+		binary.Write(reserve, binary.BigEndian, r.Size)
+	}
+	reserve.Write(make([]byte, 16))
+
+	reserveOff := uint32(headerSize+7) &^ 7
+	structOff := reserveOff + uint32(reserve.Len())
+	stringsOff := structOff + uint32(w.structure.Len())
+	total := stringsOff + uint32(w.strings.Len())
+
+	out := make([]byte, reserveOff, total)
+	be := binary.BigEndian
+	be.PutUint32(out[0:], Magic)
+	be.PutUint32(out[4:], total)
+	be.PutUint32(out[8:], structOff)
+	be.PutUint32(out[12:], stringsOff)
+	be.PutUint32(out[16:], reserveOff)
+	be.PutUint32(out[20:], writeVersion)
+	be.PutUint32(out[24:], compatVersion)
+	be.PutUint32(out[28:], t.BootCPU)
+	be.PutUint32(out[32:], uint32(w.strings.Len()))
+	be.PutUint32(out[36:], uint32(w.structure.Len()))
+
+	out = append(out, reserve.Bytes()...)
+	out = append(out, w.structure.Bytes()...)
+	out = append(out, w.strings.Bytes()...)
+	return out
+}
+
+func (t *Tree) WriteFile(path string) error {
+	if err := os.WriteFile(path, t.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
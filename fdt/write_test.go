@@ -0,0 +1,122 @@
+package fdt
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func roundTrip(t *testing.T, tree *Tree) *Tree {
+	t.Helper()
+
+	data := tree.Bytes()
+	out, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Size != len(data) {
+		t.Errorf("size = %d, blob is %d bytes", out.Size, len(data))
+	}
+
+	return out
+}
+
+func TestBytesRoundTrip(t *testing.T) {
+	tree, err := Parse(testBlob(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := roundTrip(t, tree)
+	if !reflect.DeepEqual(out.Root, tree.Root) || out.BootCPU != tree.BootCPU || !reflect.DeepEqual(out.Reservations, tree.Reservations) {
+		t.Error("tree changed after writing it back")
+	}
+
+	if again := out.Bytes(); !bytes.Equal(again, tree.Bytes()) {
+		t.Error("writing is not deterministic")
+	}
+}
+
+func TestBytesEdits(t *testing.T) {
+	tree := &Tree{Root: &Node{}, BootCPU: 2, Reservations: []Reservation{{Address: 0x80000000, Size: 0x100000}}}
+	tree.Root.SetStrings("compatible", []string{"vendor,board", "vendor,soc"})
+	tree.Root.SetUint32("#address-cells", 2)
+
+	chosen := tree.Create("/chosen")
+	chosen.SetString("bootargs", "console=ttyS0")
+	chosen.SetUint64("linux,initrd-start", 0x1_2345_6789)
+	chosen.SetProperty("empty", nil)
+	chosen.SetProperty("odd", []byte{1, 2, 3})
+	tree.Create("/soc@0/serial@1000").SetString("status", "okay")
+	tree.Create("/soc@0/i2c@2000")
+	tree.Create("/removed").SetString("status", "disabled")
+
+	chosen.SetString("bootargs", "console=ttyS2 quiet")
+	chosen.DeleteProperty("odd")
+	if !tree.Root.DeleteChild("removed") || tree.Root.DeleteChild("missing") {
+		t.Error("DeleteChild")
+	}
+
+	if tree.Create("/soc/serial") != tree.Lookup("/soc@0/serial@1000") {
+		t.Error("Create doesn't reuse existing nodes")
+	}
+
+	out := roundTrip(t, tree)
+	if out.BootCPU != 2 || !reflect.DeepEqual(out.Reservations, tree.Reservations) {
+		t.Errorf("header = %d %+v", out.BootCPU, out.Reservations)
+	}
+
+	if got := out.Root.Strings("compatible"); !reflect.DeepEqual(got, []string{"vendor,board", "vendor,soc"}) {
+		t.Errorf("compatible = %q", got)
+	}
+
+	chosen = out.Lookup("/chosen")
+	if chosen == nil {
+		t.Fatal("/chosen not found")
+	}
+
+	if got := chosen.String("bootargs"); got != "console=ttyS2 quiet" {
+		t.Errorf("bootargs = %q", got)
+	}
+
+	if got, ok := chosen.Uint64("linux,initrd-start"); !ok || got != 0x1_2345_6789 {
+		t.Errorf("initrd-start = %#x", got)
+	}
+
+	if value, ok := chosen.Property("empty"); !ok || len(value) != 0 {
+		t.Errorf("empty = %v, %v", value, ok)
+	}
+
+	if _, ok := chosen.Property("odd"); ok {
+		t.Error("deleted property is still there")
+	}
+
+	if out.Lookup("/removed") != nil || out.Lookup("/soc/i2c") == nil {
+		t.Error("unexpected nodes")
+	}
+
+	if got := out.Lookup("/soc/serial").String("status"); got != "okay" {
+		t.Errorf("status = %q", got)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	tree := &Tree{Root: &Node{}}
+	tree.Root.SetString("model", "test")
+
+	path := filepath.Join(t.TempDir(), "test.dtb")
+	if err := tree.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Root.String("model") != "test" {
+		t.Errorf("model = %q", out.Root.String("model"))
+	}
+}
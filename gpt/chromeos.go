@@ -0,0 +1,188 @@
+package gpt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+)
+
+const (
+	priorityShift   = 48
+	triesShift      = 52
+	successfulShift = 56
+
+	attributesOffset = 48
+)
+
+func (p Partition) Priority() int {
+	return int(p.Attributes >> priorityShift & 0xf)
+}
+
+func (p Partition) Tries() int {
+	return int(p.Attributes >> triesShift & 0xf)
+}
+
+func (p Partition) Successful() bool {
+	return p.Attributes>>successfulShift&1 == 1
+}
+
+func (p *Partition) SetPriority(priority int) {
+	p.Attributes = p.Attributes&^(0xf<<priorityShift) | uint64(priority&0xf)<<priorityShift
+}
+
+func (p *Partition) SetTries(tries int) {
+	p.Attributes = p.Attributes&^(0xf<<triesShift) | uint64(tries&0xf)<<triesShift
+}
+
+func (p *Partition) SetSuccessful(successful bool) {
+	p.Attributes &^= 1 << successfulShift
+	if successful {
+		p.Attributes |= 1 << successfulShift
+	}
+}
+
+func (p Partition) Bootable() bool {
+	return p.Type == ChromeOSKernel && p.Priority() > 0 && (p.Successful() || p.Tries() > 0)
+}
+
+func (t *Table) KernelSlots() []Partition {
+	slots := []Partition{}
+	for _, p := range t.Partitions {
+		if p.Bootable() {
+			slots = append(slots, p)
+		}
+	}
+
+	sort.SliceStable(slots, func(i, j int) bool {
+		return slots[i].Priority() > slots[j].Priority()
+	})
+
+	return slots
+}
+
+func (t *Table) SelectKernel() (Partition, bool) {
+	slots := t.KernelSlots()
+	if len(slots) == 0 {
+		return Partition{}, false
+	}
+
+	return slots[0], true
+}
+
+type ReadWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+func MarkTried(rw ReadWriterAt, index int) (Partition, error) {
+	table, err := Read(rw)
+	if err != nil {
+		return Partition{}, err
+	}
+
+	p, ok := table.Partition(index)
+	if !ok {
+		return p, fmt.Errorf("partition %d not found", index)
+	}
+
+	if p.Successful() {
+		return p, nil
+	}
+
+	if p.Tries() == 0 {
+		return p, fmt.Errorf("partition %d has no tries left", index)
+	}
+
+	p.SetTries(p.Tries() - 1)
+	return p, table.SetAttributes(rw, index, p.Attributes)
+}
+
+func MarkTriedFile(path string, index int) (Partition, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return Partition{}, err
+	}
+	defer f.Close()
+
+	p, err := MarkTried(f, index)
+	if err != nil {
+		return p, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return p, f.Sync()
+}
+
+func (t *Table) SetAttributes(rw ReadWriterAt, index int, attributes uint64) error {
+	if index < 1 || index > int(t.EntryCount) {
+		return fmt.Errorf("partition %d is out of range", index)
+	}
+
+	headers := []int64{int64(t.CurrentLBA), int64(t.BackupLBA)}
+	for i, lba := range headers {
+		err := t.setEntryAttributes(rw, lba*int64(t.SectorSize), index, attributes)
+		if err != nil && (i == 0 || !errors.Is(err, ErrNoTable)) {
+			return err
+		}
+	}
+
+	for i := range t.Partitions {
+		if t.Partitions[i].Index == index {
+			t.Partitions[i].Attributes = attributes
+		}
+	}
+
+	return nil
+}
+
+func (t *Table) setEntryAttributes(rw ReadWriterAt, offset int64, index int, attributes uint64) error {
+	le := binary.LittleEndian
+	sectorSize := t.SectorSize
+
+	header := make([]byte, sectorSize)
+	if _, err := rw.ReadAt(header, offset); err != nil {
+		return fmt.Errorf("header: %w", err)
+	}
+
+	if string(header[:8]) != signature {
+		return ErrNoTable
+	}
+
+	size := le.Uint32(header[12:])
+	if size < headerSize || int(size) > sectorSize {
+		return fmt.Errorf("header size %d is invalid", size)
+	}
+
+	entriesOffset := int64(le.Uint64(header[72:])) * int64(sectorSize)
+	count, entrySize := le.Uint32(header[80:]), le.Uint32(header[84:])
+	if count != t.EntryCount || entrySize != t.EntrySize {
+		return fmt.Errorf("partition entry layout %dx%d doesn't match %dx%d", count, entrySize, t.EntryCount, t.EntrySize)
+	}
+
+	entries := make([]byte, int(t.EntryCount)*int(t.EntrySize))
+	if _, err := rw.ReadAt(entries, entriesOffset); err != nil {
+		return fmt.Errorf("partition entries: %w", err)
+	}
+
+	if crc32.ChecksumIEEE(entries) != le.Uint32(header[88:]) {
+		return fmt.Errorf("partition entries: %w", ErrBadChecksum)
+	}
+
+	le.PutUint64(entries[(index-1)*int(entrySize)+attributesOffset:], attributes)
+	le.PutUint32(header[88:], crc32.ChecksumIEEE(entries))
+	le.PutUint32(header[16:], 0)
+	le.PutUint32(header[16:], crc32.ChecksumIEEE(header[:size]))
+
+	if _, err := rw.WriteAt(entries, entriesOffset); err != nil {
+		return fmt.Errorf("partition entries: %w", err)
+	}
+
+	if _, err := rw.WriteAt(header[:size], offset); err != nil {
+		return fmt.Errorf("header: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package gpt
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"testing"
+)
+
+func kernelAttributes(priority, tries int, successful bool) uint64 {
+	p := Partition{}
+	p.SetPriority(priority)
+	p.SetTries(tries)
+	p.SetSuccessful(successful)
+	return p.Attributes
+}
+
+func readAttributes(t *testing.T, path string, index int) []uint64 {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	le := binary.LittleEndian
+	out := []uint64{}
+	for _, lba := range []int{1, testSectors - 1} {
+		header := append([]byte{}, data[lba*512:lba*512+headerSize]...)
+		sum := le.Uint32(header[16:])
+		le.PutUint32(header[16:], 0)
+		if crc32.ChecksumIEEE(header) != sum {
+			t.Errorf("LBA %d: header checksum mismatch", lba)
+		}
+
+		if current := le.Uint64(header[24:]); current != uint64(lba) {
+			t.Errorf("LBA %d: current LBA = %d", lba, current)
+		}
+
+		start := int(le.Uint64(header[72:])) * 512
+		entries := data[start : start+testEntryCount*testEntrySize]
+		if crc32.ChecksumIEEE(entries) != le.Uint32(header[88:]) {
+			t.Errorf("LBA %d: entries checksum mismatch", lba)
+		}
+
+		out = append(out, le.Uint64(entries[(index-1)*testEntrySize+attributesOffset:]))
+	}
+
+	return out
+}
+
+func TestPartitionAttributes(t *testing.T) {
+	p := Partition{Type: ChromeOSKernel}
+	p.SetPriority(15)
+	p.SetTries(3)
+	p.SetSuccessful(true)
+	if p.Priority() != 15 || p.Tries() != 3 || !p.Successful() || !p.Bootable() {
+		t.Errorf("unexpected attributes %#x", p.Attributes)
+	}
+
+	p.SetPriority(17)
+	p.SetSuccessful(false)
+	if p.Priority() != 1 || p.Tries() != 3 || p.Successful() {
+		t.Errorf("unexpected attributes %#x", p.Attributes)
+	}
+
+	p.SetTries(0)
+	if p.Bootable() {
+		t.Error("partition without tries or success is bootable")
+	}
+}
+
+func TestKernelSlots(t *testing.T) {
+	path := writeTestImage(t, []testPartition{
+		{typ: ChromeOSKernel, first: 34, last: 49, attributes: kernelAttributes(1, 0, true), name: "KERN-A"},
+		{typ: ChromeOSKernel, first: 50, last: 65, attributes: kernelAttributes(2, 3, false), name: "KERN-B"},
+		{typ: ChromeOSKernel, first: 66, last: 81, attributes: kernelAttributes(3, 0, false), name: "KERN-C"},
+		{typ: LinuxData, first: 82, last: 97, attributes: kernelAttributes(5, 1, true), name: "root"},
+	})
+
+	table, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slots := table.KernelSlots()
+	if len(slots) != 2 || slots[0].Name != "KERN-B" || slots[1].Name != "KERN-A" {
+		t.Errorf("unexpected slots %+v", slots)
+	}
+
+	if p, ok := table.SelectKernel(); !ok || p.Name != "KERN-B" {
+		t.Errorf("selected %+v", p)
+	}
+}
+
+func TestMarkTried(t *testing.T) {
+	tests := []struct {
+		name       string
+		attributes uint64
+		want       uint64
+		fails      bool
+	}{
+		{"decrements tries", kernelAttributes(2, 3, false), kernelAttributes(2, 2, false), false},
+		{"last try", kernelAttributes(2, 1, false), kernelAttributes(2, 0, false), false},
+		{"successful is unchanged", kernelAttributes(1, 2, true), kernelAttributes(1, 2, true), false},
+		{"no tries left", kernelAttributes(2, 0, false), kernelAttributes(2, 0, false), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTestImage(t, []testPartition{
+				{typ: ChromeOSKernel, first: 34, last: 49, attributes: kernelAttributes(1, 0, true), name: "KERN-A"},
+				{typ: ChromeOSKernel, first: 50, last: 65, attributes: test.attributes, name: "KERN-B"},
+			})
+
+			p, err := MarkTriedFile(path, 2)
+			if (err != nil) != test.fails {
+				t.Fatalf("err = %v", err)
+			}
+
+			if err == nil && p.Attributes != test.want {
+				t.Errorf("returned attributes %#x, want %#x", p.Attributes, test.want)
+			}
+
+			for _, got := range readAttributes(t, path, 2) {
+				if got != test.want {
+					t.Errorf("stored attributes %#x, want %#x", got, test.want)
+				}
+			}
+
+			if got := readAttributes(t, path, 1); got[0] != kernelAttributes(1, 0, true) || got[1] != got[0] {
+				t.Errorf("other partition changed: %#x", got)
+			}
+
+			if _, err := ReadFile(path); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestSetAttributes(t *testing.T) {
+	path := writeTestImage(t, []testPartition{
+		{typ: ChromeOSKernel, first: 34, last: 49, attributes: kernelAttributes(1, 0, true), name: "KERN-A"},
+		{typ: ChromeOSKernel, first: 50, last: 65, attributes: kernelAttributes(0, 0, false), name: "KERN-B"},
+	})
+
+	table, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	want := kernelAttributes(2, 15, false)
+	if err := table.SetAttributes(f, 2, want); err != nil {
+		t.Fatal(err)
+	}
+
+	if p, _ := table.Partition(2); p.Attributes != want {
+		t.Errorf("table attributes %#x, want %#x", p.Attributes, want)
+	}
+
+	for _, got := range readAttributes(t, path, 2) {
+		if got != want {
+			t.Errorf("stored attributes %#x, want %#x", got, want)
+		}
+	}
+
+	if p, ok := table.SelectKernel(); !ok || p.Name != "KERN-B" {
+		t.Errorf("selected %+v", p)
+	}
+
+	for _, index := range []int{0, testEntryCount + 1} {
+		if err := table.SetAttributes(f, index, want); err == nil {
+			t.Errorf("index %d: expected an error", index)
+		}
+	}
+}
+
+func TestSetAttributesLayoutMismatch(t *testing.T) {
+	path := writeTestImage(t, []testPartition{
+		{typ: ChromeOSKernel, first: 34, last: 49, attributes: kernelAttributes(1, 2, false), name: "KERN-A"},
+	})
+
+	table, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corruptHeader(t, path, 80, 0x7fffffff)
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := table.SetAttributes(f, 1, 0); err == nil {
+		t.Error("expected an error")
+	}
+}
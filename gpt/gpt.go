@@ -0,0 +1,227 @@
+package gpt
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	signature  = "EFI PART"
+	headerSize = 92
+
+	maxEntryCount     = 1024
+	maxEntryArraySize = 1 << 20
+)
+
+var (
+	ErrNoTable     = errors.New("no GPT signature found")
+	ErrBadChecksum = errors.New("GPT checksum mismatch")
+
+	ChromeOSKernel = MustParseGUID("FE3A2A5D-4F32-41A7-B725-ACCC3285A309")
+	ChromeOSRoot   = MustParseGUID("3CB8E202-3B7E-47DD-8A3C-7FF2A13CFCEC")
+	LinuxData      = MustParseGUID("0FC63DAF-8483-4772-8E79-3D69D8477DE4")
+	EFISystem      = MustParseGUID("C12A7328-F81F-11D2-BA4B-00A0C93EC93B")
+)
+
+type GUID [16]byte
+
+func (g GUID) String() string {
+	le := binary.LittleEndian
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		le.Uint32(g[0:4]), le.Uint16(g[4:6]), le.Uint16(g[6:8]), g[8:10], g[10:16])
+}
+
+func (g GUID) IsZero() bool {
+	return g == GUID{}
+}
+
+func ParseGUID(s string) (GUID, error) {
+	var g GUID
+
+	raw, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(raw) != 16 {
+		return g, fmt.Errorf("invalid GUID %s", s)
+	}
+
+	binary.LittleEndian.PutUint32(g[0:4], binary.BigEndian.Uint32(raw[0:4]))
+	binary.LittleEndian.PutUint16(g[4:6], binary.BigEndian.Uint16(raw[4:6]))
+	binary.LittleEndian.PutUint16(g[6:8], binary.BigEndian.Uint16(raw[6:8]))
+	copy(g[8:], raw[8:])
+
+	return g, nil
+}
+
+func MustParseGUID(s string) GUID {
+	g, err := ParseGUID(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return g
+}
+
+type Header struct {
+	CurrentLBA     uint64
+	BackupLBA      uint64
+	FirstUsableLBA uint64
+	LastUsableLBA  uint64
+	DiskGUID       GUID
+	EntriesLBA     uint64
+	EntryCount     uint32
+	EntrySize      uint32
+}
+
+type Partition struct {
+	Index      int
+	Type       GUID
+	UUID       GUID
+	FirstLBA   uint64
+	LastLBA    uint64
+	Attributes uint64
+	Name       string
+}
+
+func (p Partition) Size(sectorSize int) uint64 {
+	return (p.LastLBA - p.FirstLBA + 1) * uint64(sectorSize)
+}
+
+type Table struct {
+	Header
+	SectorSize int
+	Partitions []Partition
+}
+
+func ReadFile(path string) (*Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	table, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return table, nil
+}
+
+func Read(r io.ReaderAt) (*Table, error) {
+	var err error
+	for _, sectorSize := range []int{512, 4096} {
+		var table *Table
+		if table, err = ReadSectorSize(r, sectorSize); err == nil {
+			return table, nil
+		}
+
+		if !errors.Is(err, ErrNoTable) {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+func ReadSectorSize(r io.ReaderAt, sectorSize int) (*Table, error) {
+	raw := make([]byte, sectorSize)
+	if _, err := r.ReadAt(raw, int64(sectorSize)); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+
+	if string(raw[:8]) != signature {
+		return nil, ErrNoTable
+	}
+
+	le := binary.LittleEndian
+	size := le.Uint32(raw[12:])
+	if size < headerSize || int(size) > sectorSize {
+		return nil, fmt.Errorf("header size %d is invalid", size)
+	}
+
+	header := append([]byte{}, raw[:size]...)
+	crc := le.Uint32(header[16:])
+	le.PutUint32(header[16:], 0)
+	if crc32.ChecksumIEEE(header) != crc {
+		return nil, fmt.Errorf("header: %w", ErrBadChecksum)
+	}
+
+	table := &Table{
+		SectorSize: sectorSize,
+		Header: Header{
+			CurrentLBA:     le.Uint64(raw[24:]),
+			BackupLBA:      le.Uint64(raw[32:]),
+			FirstUsableLBA: le.Uint64(raw[40:]),
+			LastUsableLBA:  le.Uint64(raw[48:]),
+			EntriesLBA:     le.Uint64(raw[72:]),
+			EntryCount:     le.Uint32(raw[80:]),
+			EntrySize:      le.Uint32(raw[84:]),
+		},
+	}
+	copy(table.DiskGUID[:], raw[56:72])
+
+	if err := checkEntryLayout(table.EntryCount, table.EntrySize, sectorSize); err != nil {
+		return nil, err
+	}
+
+	entries := make([]byte, int(table.EntryCount)*int(table.EntrySize))
+	if _, err := r.ReadAt(entries, int64(table.EntriesLBA)*int64(sectorSize)); err != nil {
+		return nil, fmt.Errorf("partition entries: %w", err)
+	}
+
+	if crc32.ChecksumIEEE(entries) != le.Uint32(raw[88:]) {
+		return nil, fmt.Errorf("partition entries: %w", ErrBadChecksum)
+	}
+
+	for i := 0; i < int(table.EntryCount); i++ {
+		entry := entries[i*int(table.EntrySize):]
+
+		p := Partition{
+			Index:      i + 1,
+			FirstLBA:   le.Uint64(entry[32:]),
+			LastLBA:    le.Uint64(entry[40:]),
+			Attributes: le.Uint64(entry[48:]),
+		}
+		copy(p.Type[:], entry[0:16])
+		copy(p.UUID[:], entry[16:32])
+
+		if p.Type.IsZero() {
+			continue
+		}
+
+		name := make([]uint16, 36)
+		for j := range name {
+			name[j] = le.Uint16(entry[56+j*2:])
+		}
+
+		p.Name = strings.TrimRight(string(utf16.Decode(name)), "\x00")
+		table.Partitions = append(table.Partitions, p)
+	}
+
+	return table, nil
+}
+
+func checkEntryLayout(count uint32, size uint32, sectorSize int) error {
+	if size < 128 || size&(size-1) != 0 || int(size) > sectorSize || count > maxEntryCount ||
+		uint64(count)*uint64(size) > maxEntryArraySize {
+		return fmt.Errorf("partition entry layout %dx%d is invalid", count, size)
+	}
+
+	return nil
+}
+
+func (t *Table) Partition(index int) (Partition, bool) {
+	for _, p := range t.Partitions {
+		if p.Index == index {
+			return p, true
+		}
+	}
+
+	return Partition{}, false
+}
@@ -0,0 +1,190 @@
+package gpt
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+const (
+	testSectors    = 256
+	testEntryCount = 128
+	testEntrySize  = 128
+)
+
+var testDiskGUID = MustParseGUID("11111111-2222-3333-4444-555555555555")
+
+type testPartition struct {
+	typ        GUID
+	uuid       GUID
+	first      uint64
+	last       uint64
+	attributes uint64
+	name       string
+}
+
+func testEntries(parts []testPartition) []byte {
+	le := binary.LittleEndian
+	entries := make([]byte, testEntryCount*testEntrySize)
+	for i, p := range parts {
+		entry := entries[i*testEntrySize:]
+		copy(entry[0:], p.typ[:])
+		copy(entry[16:], p.uuid[:])
+		le.PutUint64(entry[32:], p.first)
+		le.PutUint64(entry[40:], p.last)
+		le.PutUint64(entry[48:], p.attributes)
+		for j, c := range utf16.Encode([]rune(p.name)) {
+			le.PutUint16(entry[56+j*2:], c)
+		}
+	}
+
+	return entries
+}
+
+func testHeader(current, backup, entriesLBA uint64, entries []byte) []byte {
+	le := binary.LittleEndian
+	header := make([]byte, headerSize)
+	copy(header, signature)
+	le.PutUint32(header[8:], 0x00010000)
+	le.PutUint32(header[12:], headerSize)
+	le.PutUint64(header[24:], current)
+	le.PutUint64(header[32:], backup)
+	le.PutUint64(header[40:], 34)
+	le.PutUint64(header[48:], testSectors-34)
+	copy(header[56:], testDiskGUID[:])
+	le.PutUint64(header[72:], entriesLBA)
+	le.PutUint32(header[80:], testEntryCount)
+	le.PutUint32(header[84:], testEntrySize)
+	le.PutUint32(header[88:], crc32.ChecksumIEEE(entries))
+	le.PutUint32(header[16:], crc32.ChecksumIEEE(header))
+	return header
+}
+
+func writeTestImage(t *testing.T, parts []testPartition) string {
+	t.Helper()
+
+	image := make([]byte, testSectors*512)
+	entries := testEntries(parts)
+	last := uint64(testSectors - 1)
+
+	copy(image[512:], testHeader(1, last, 2, entries))
+	copy(image[2*512:], entries)
+	copy(image[(last-32)*512:], entries)
+	copy(image[last*512:], testHeader(last, 1, last-32, entries))
+
+	path := filepath.Join(t.TempDir(), "disk.img")
+	if err := os.WriteFile(path, image, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestReadFile(t *testing.T) {
+	kernel := MustParseGUID("aaaaaaaa-0000-0000-0000-000000000001")
+	path := writeTestImage(t, []testPartition{
+		{typ: ChromeOSKernel, uuid: kernel, first: 34, last: 99, attributes: 1 << 48, name: "KERN-A"},
+		{typ: LinuxData, uuid: MustParseGUID("aaaaaaaa-0000-0000-0000-000000000002"), first: 100, last: 200, name: "root"},
+	})
+
+	table, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if table.SectorSize != 512 || table.DiskGUID != testDiskGUID || table.EntryCount != testEntryCount {
+		t.Errorf("unexpected header %+v", table.Header)
+	}
+
+	if len(table.Partitions) != 2 {
+		t.Fatalf("got %d partitions, want 2", len(table.Partitions))
+	}
+
+	p, ok := table.Partition(1)
+	if !ok || p.Type != ChromeOSKernel || p.UUID != kernel || p.Name != "KERN-A" || p.FirstLBA != 34 || p.LastLBA != 99 {
+		t.Errorf("unexpected partition %+v", p)
+	}
+
+	if p.Size(512) != 66*512 {
+		t.Errorf("size = %d", p.Size(512))
+	}
+
+	if got := kernel.String(); got != "aaaaaaaa-0000-0000-0000-000000000001" {
+		t.Errorf("GUID string = %s", got)
+	}
+}
+
+func corruptHeader(t *testing.T, path string, off int, value uint32) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := data[512 : 512+headerSize]
+	le := binary.LittleEndian
+	le.PutUint32(header[off:], value)
+	le.PutUint32(header[16:], 0)
+	le.PutUint32(header[16:], crc32.ChecksumIEEE(header))
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadInvalidLayout(t *testing.T) {
+	tests := []struct {
+		name  string
+		off   int
+		value uint32
+	}{
+		{"entry size too small", 84, 64},
+		{"entry size not a power of two", 84, 384},
+		{"entry size larger than sector", 84, 1024},
+		{"huge entry size", 84, 0x80000000},
+		{"too many entries", 80, 4096},
+		{"header size too small", 12, 32},
+		{"header size too large", 12, 1024},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTestImage(t, nil)
+			corruptHeader(t, path, test.off, test.value)
+			if _, err := ReadFile(path); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestReadChecksums(t *testing.T) {
+	path := writeTestImage(t, []testPartition{{typ: LinuxData, first: 34, last: 40}})
+	data, _ := os.ReadFile(path)
+
+	data[512+60] ^= 1
+	os.WriteFile(path, data, 0o644)
+	if _, err := ReadFile(path); !errors.Is(err, ErrBadChecksum) {
+		t.Errorf("corrupt header: got %v", err)
+	}
+
+	data[512+60] ^= 1
+	data[2*512+40] ^= 1
+	os.WriteFile(path, data, 0o644)
+	if _, err := ReadFile(path); !errors.Is(err, ErrBadChecksum) {
+		t.Errorf("corrupt entries: got %v", err)
+	}
+}
+
+func TestReadNoTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.img")
+	os.WriteFile(path, make([]byte, 16384), 0o644)
+	if _, err := ReadFile(path); !errors.Is(err, ErrNoTable) {
+		t.Errorf("got %v, want ErrNoTable", err)
+	}
+}
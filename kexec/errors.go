@@ -0,0 +1,14 @@
+package kexec
+
+import "errors"
+
+var (
+	ErrKeyRejected  = errors.New("kernel signature was rejected")
+	ErrNoMemory     = errors.New("not enough memory to place the kernel")
+	ErrInvalid      = errors.New("kernel image or arguments are invalid")
+	ErrNotKernel    = errors.New("image format is not supported by this kernel")
+	ErrPermission   = errors.New("kexec is not permitted")
+	ErrBusy         = errors.New("kexec is busy")
+	ErrNotSupported = errors.New("kexec_file_load is not supported by this kernel")
+	ErrTooLarge     = errors.New("image or cmdline is too large")
+)
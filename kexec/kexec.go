@@ -0,0 +1,113 @@
+//go:build linux
+
+package kexec
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+var errnoErrors = map[unix.Errno]error{
+	unix.EKEYREJECTED:  ErrKeyRejected,
+	unix.EKEYREVOKED:   ErrKeyRejected,
+	unix.EBADMSG:       ErrKeyRejected,
+	unix.ENOMEM:        ErrNoMemory,
+	unix.EADDRNOTAVAIL: ErrNoMemory,
+	unix.EINVAL:        ErrInvalid,
+	unix.ENOEXEC:       ErrNotKernel,
+	unix.EPERM:         ErrPermission,
+	unix.EACCES:        ErrPermission,
+	unix.EBUSY:         ErrBusy,
+	unix.ENOSYS:        ErrNotSupported,
+	unix.EOPNOTSUPP:    ErrNotSupported,
+	unix.E2BIG:         ErrTooLarge,
+	unix.EFBIG:         ErrTooLarge,
+}
+
+type Error struct {
+	Op    string
+	Errno unix.Errno
+	Err   error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("kexec %s: %s", e.Op, e.Errno)
+	}
+
+	return fmt.Sprintf("kexec %s: %s (%s)", e.Op, e.Err, e.Errno)
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Errno}
+	}
+
+	return []error{e.Err, e.Errno}
+}
+
+func wrap(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	errno, ok := err.(unix.Errno)
+	if !ok {
+		return fmt.Errorf("kexec %s: %w", op, err)
+	}
+
+	return &Error{Op: op, Errno: errno, Err: errnoErrors[errno]}
+}
+
+func Load(kernel string, initrd string, cmdline string) error {
+	k, err := os.Open(kernel)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+
+	if initrd == "" {
+		return LoadFile(k, nil, cmdline)
+	}
+
+	i, err := os.Open(initrd)
+	if err != nil {
+		return err
+	}
+	defer i.Close()
+
+	return LoadFile(k, i, cmdline)
+}
+
+func LoadFile(kernel *os.File, initrd *os.File, cmdline string) error {
+	flags, initrdFd := 0, -1
+	if initrd == nil {
+		flags |= unix.KEXEC_FILE_NO_INITRAMFS
+	} else {
+		initrdFd = int(initrd.Fd())
+	}
+
+	return wrap("load", kexecFileLoad(int(kernel.Fd()), initrdFd, cmdline, flags))
+}
+
+func Unload() error {
+	return wrap("unload", kexecFileLoad(-1, -1, "", unix.KEXEC_FILE_UNLOAD))
+}
+
+func Loaded() bool {
+	data, err := os.ReadFile("/sys/kernel/kexec_loaded")
+	return err == nil && strings.TrimSpace(string(data)) == "1"
+}
+
+func Exec() error {
+	if !Loaded() {
+		return &Error{Op: "exec", Errno: unix.ENOENT, Err: errors.New("no kernel is loaded")}
+	}
+
+	unix.Sync()
+	return wrap("exec", unix.Reboot(unix.LINUX_REBOOT_CMD_KEXEC))
+}
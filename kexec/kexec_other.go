@@ -0,0 +1,25 @@
+//go:build !linux
+
+package kexec
+
+import "os"
+
+func Load(string, string, string) error {
+	return ErrNotSupported
+}
+
+func LoadFile(*os.File, *os.File, string) error {
+	return ErrNotSupported
+}
+
+func Unload() error {
+	return ErrNotSupported
+}
+
+func Loaded() bool {
+	return false
+}
+
+func Exec() error {
+	return ErrNotSupported
+}
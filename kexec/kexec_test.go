@@ -0,0 +1,71 @@
+//go:build linux
+
+package kexec
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestWrap(t *testing.T) {
+	if err := wrap("load", nil); err != nil {
+		t.Errorf("nil: got %v", err)
+	}
+
+	err := wrap("load", fs.ErrClosed)
+	if !errors.Is(err, fs.ErrClosed) || err.Error() != "kexec load: file already closed" {
+		t.Errorf("non-errno: got %v", err)
+	}
+
+	err = wrap("exec", unix.EIO)
+	if !errors.Is(err, unix.EIO) || err.Error() != "kexec exec: input/output error" {
+		t.Errorf("unmapped errno: got %v", err)
+	}
+
+	var kerr *Error
+	if !errors.As(err, &kerr) || kerr.Op != "exec" || kerr.Err != nil {
+		t.Errorf("unmapped errno: got %#v", err)
+	}
+}
+
+func TestErrnoErrors(t *testing.T) {
+	tests := []struct {
+		errno unix.Errno
+		want  error
+	}{
+		{unix.EKEYREJECTED, ErrKeyRejected},
+		{unix.EKEYREVOKED, ErrKeyRejected},
+		{unix.EBADMSG, ErrKeyRejected},
+		{unix.ENOMEM, ErrNoMemory},
+		{unix.EADDRNOTAVAIL, ErrNoMemory},
+		{unix.EINVAL, ErrInvalid},
+		{unix.ENOEXEC, ErrNotKernel},
+		{unix.EPERM, ErrPermission},
+		{unix.EACCES, ErrPermission},
+		{unix.EBUSY, ErrBusy},
+		{unix.ENOSYS, ErrNotSupported},
+		{unix.EOPNOTSUPP, ErrNotSupported},
+		{unix.E2BIG, ErrTooLarge},
+		{unix.EFBIG, ErrTooLarge},
+	}
+
+	for _, test := range tests {
+		err := wrap("load", test.errno)
+		if !errors.Is(err, test.want) || !errors.Is(err, test.errno) {
+			t.Errorf("%s: got %v, want %v", test.errno, err, test.want)
+		}
+
+		if want := "kexec load: " + test.want.Error() + " (" + test.errno.Error() + ")"; err.Error() != want {
+			t.Errorf("%s: got %q, want %q", test.errno, err, want)
+		}
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	if err := Load("/nonexistent/vmlinuz", "", ""); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing kernel: got %v", err)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build linux && !(amd64 || arm64 || arm || riscv64 || loong64 || ppc || ppc64 || ppc64le || s390x)
+
+package kexec
+
+import "golang.org/x/sys/unix"
+
+func kexecFileLoad(int, int, string, int) error {
+	return unix.ENOSYS
+}
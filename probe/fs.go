@@ -0,0 +1,189 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+type Filesystem struct {
+	Type  string
+	UUID  string
+	Label string
+}
+
+type superblock struct {
+	offset int64
+	size   int
+	detect func(sb []byte) (Filesystem, bool)
+}
+
+var superblocks = []superblock{
+	{offset: 1024, size: 1024, detect: detectExt},
+	{offset: 0x10000, size: 0x1000, detect: detectBtrfs},
+	{offset: 0, size: 512, detect: detectXFS},
+	{offset: 1024, size: 2048, detect: detectF2FS},
+	{offset: 1024, size: 128, detect: detectEROFS},
+	{offset: 0, size: 4, detect: detectSquashFS},
+	{offset: 0, size: 512, detect: detectExFAT},
+	{offset: 0, size: 512, detect: detectFAT},
+	{offset: 0x8000, size: 2048, detect: detectISO9660},
+	{offset: 0, size: 4096, detect: detectSwap},
+}
+
+func ReadFilesystem(r io.ReaderAt) (Filesystem, error) {
+	var readErr error
+	for _, s := range superblocks {
+		sb := make([]byte, s.size)
+		if _, err := r.ReadAt(sb, s.offset); err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				readErr = err
+			}
+
+			continue
+		}
+
+		if fs, ok := s.detect(sb); ok {
+			return fs, nil
+		}
+	}
+
+	return Filesystem{}, readErr
+}
+
+func formatUUID(b []byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func formatSerial(serial uint32) string {
+	return fmt.Sprintf("%04X-%04X", serial>>16, serial&0xffff)
+}
+
+func label(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+
+	return strings.TrimSpace(string(b))
+}
+
+func utf16Label(b []byte) string {
+	name := make([]uint16, len(b)/2)
+	for i := range name {
+		name[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+
+	return strings.TrimRight(string(utf16.Decode(name)), "\x00")
+}
+
+const (
+	extHasJournal      = 0x4
+	extIncompatExt3    = 0x2 | 0x4 | 0x10
+	extROCompatExt3    = 0x1 | 0x2 | 0x4
+	extIncompatJournal = 0x8
+)
+
+func detectExt(sb []byte) (Filesystem, bool) {
+	le := binary.LittleEndian
+	if le.Uint16(sb[56:]) != 0xef53 {
+		return Filesystem{}, false
+	}
+
+	fs := Filesystem{Type: "ext2", UUID: formatUUID(sb[104:120]), Label: label(sb[120:136])}
+
+	compat, incompat, roCompat := le.Uint32(sb[92:]), le.Uint32(sb[96:]), le.Uint32(sb[100:])
+	switch {
+	case incompat&extIncompatJournal != 0:
+		fs.Type = "jbd"
+	case incompat&^extIncompatExt3 != 0 || roCompat&^extROCompatExt3 != 0:
+		fs.Type = "ext4"
+	case compat&extHasJournal != 0:
+		fs.Type = "ext3"
+	}
+
+	return fs, true
+}
+
+func detectBtrfs(sb []byte) (Filesystem, bool) {
+	if string(sb[64:72]) != "_BHRfS_M" {
+		return Filesystem{}, false
+	}
+
+	return Filesystem{Type: "btrfs", UUID: formatUUID(sb[32:48]), Label: label(sb[299:555])}, true
+}
+
+func detectXFS(sb []byte) (Filesystem, bool) {
+	if string(sb[0:4]) != "XFSB" {
+		return Filesystem{}, false
+	}
+
+	return Filesystem{Type: "xfs", UUID: formatUUID(sb[32:48]), Label: label(sb[108:120])}, true
+}
+
+func detectF2FS(sb []byte) (Filesystem, bool) {
+	if binary.LittleEndian.Uint32(sb) != 0xf2f52010 {
+		return Filesystem{}, false
+	}
+
+	return Filesystem{Type: "f2fs", UUID: formatUUID(sb[108:124]), Label: utf16Label(sb[124:1148])}, true
+}
+
+func detectEROFS(sb []byte) (Filesystem, bool) {
+	if binary.LittleEndian.Uint32(sb) != 0xe0f5e1e2 {
+		return Filesystem{}, false
+	}
+
+	return Filesystem{Type: "erofs", UUID: formatUUID(sb[48:64]), Label: label(sb[64:80])}, true
+}
+
+func detectSquashFS(sb []byte) (Filesystem, bool) {
+	return Filesystem{Type: "squashfs"}, string(sb) == "hsqs"
+}
+
+func detectExFAT(sb []byte) (Filesystem, bool) {
+	if string(sb[3:11]) != "EXFAT   " {
+		return Filesystem{}, false
+	}
+
+	return Filesystem{Type: "exfat", UUID: formatSerial(binary.LittleEndian.Uint32(sb[100:]))}, true
+}
+
+func detectFAT(sb []byte) (Filesystem, bool) {
+	if sb[510] != 0x55 || sb[511] != 0xaa || (sb[0] != 0xeb && sb[0] != 0xe9) {
+		return Filesystem{}, false
+	}
+
+	serial, name := 39, 43
+	switch {
+	case string(sb[82:87]) == "FAT32":
+		serial, name = 67, 71
+	case string(sb[54:57]) != "FAT" && string(sb[3:8]) != "MSDOS" && string(sb[3:8]) != "mkfs.":
+		return Filesystem{}, false
+	}
+
+	fs := Filesystem{Type: "vfat", UUID: formatSerial(binary.LittleEndian.Uint32(sb[serial:]))}
+	if l := label(sb[name : name+11]); l != "NO NAME" {
+		fs.Label = l
+	}
+
+	return fs, true
+}
+
+func detectISO9660(sb []byte) (Filesystem, bool) {
+	if string(sb[1:6]) != "CD001" {
+		return Filesystem{}, false
+	}
+
+	return Filesystem{Type: "iso9660", Label: label(sb[40:72])}, true
+}
+
+func detectSwap(sb []byte) (Filesystem, bool) {
+	if magic := string(sb[4086:4096]); magic != "SWAPSPACE2" && magic != "SWAP-SPACE" {
+		return Filesystem{}, false
+	}
+
+	return Filesystem{Type: "swap", UUID: formatUUID(sb[1036:1052]), Label: label(sb[1052:1068])}, true
+}
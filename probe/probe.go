@@ -0,0 +1,295 @@
+package probe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"sideboot/gpt"
+)
+
+var (
+	ErrNotFound   = errors.New("no such device")
+	ErrAmbiguous  = errors.New("spec matches more than one device")
+	ErrUnreadable = errors.New("device is not readable")
+	ErrInvalid    = errors.New("invalid device spec")
+)
+
+var (
+	sysBlock = "/sys/class/block"
+	devDir   = "/dev"
+)
+
+type Device struct {
+	Name      string
+	Path      string
+	Major     int
+	Minor     int
+	Disk      string
+	Partition int
+	Size      int64
+	Bus       string
+	Removable bool
+	ReadOnly  bool
+
+	Filesystem
+	PartUUID       string
+	PartLabel      string
+	PartType       gpt.GUID
+	PartAttributes uint64
+
+	Err error
+}
+
+func (d *Device) IsPartition() bool {
+	return d.Disk != ""
+}
+
+func (d *Device) Mountable() bool {
+	switch d.Type {
+	case "", "swap", "jbd":
+		return false
+	}
+
+	return true
+}
+
+type partitionTable struct {
+	gpt       *gpt.Table
+	signature uint32
+}
+
+func Devices() ([]*Device, error) {
+	entries, err := os.ReadDir(sysBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := map[string]*partitionTable{}
+	devices := []*Device{}
+	for _, entry := range entries {
+		dev, err := probe(entry.Name(), tables)
+		if err != nil {
+			continue
+		}
+
+		devices = append(devices, dev)
+	}
+
+	return devices, nil
+}
+
+func Probe(name string) (*Device, error) {
+	return probe(name, map[string]*partitionTable{})
+}
+
+func probe(name string, tables map[string]*partitionTable) (*Device, error) {
+	sys, err := filepath.EvalSymlinks(filepath.Join(sysBlock, name))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, ErrNotFound)
+	}
+
+	dev := &Device{Name: name, Path: filepath.Join(devDir, name)}
+	if _, err := fmt.Sscanf(readSys(sys, "dev"), "%d:%d", &dev.Major, &dev.Minor); err != nil {
+		return nil, fmt.Errorf("%s: no device number", name)
+	}
+
+	sectors, _ := strconv.ParseInt(readSys(sys, "size"), 10, 64)
+	dev.Size = sectors * 512
+	dev.ReadOnly = readSys(sys, "ro") == "1"
+
+	disk := sys
+	if partition := readSys(sys, "partition"); partition != "" {
+		dev.Partition, _ = strconv.Atoi(partition)
+		disk = filepath.Dir(sys)
+		dev.Disk = filepath.Base(disk)
+	}
+
+	dev.Removable = readSys(disk, "removable") == "1"
+	dev.Bus = bus(sys)
+
+	if dev.Size == 0 {
+		dev.Err = fmt.Errorf("%s: %w: empty device", dev.Path, ErrUnreadable)
+		return dev, nil
+	}
+
+	f, err := os.Open(dev.Path)
+	if err != nil {
+		dev.Err = fmt.Errorf("%s: %w: %s", dev.Path, ErrUnreadable, err)
+		return dev, nil
+	}
+	defer f.Close()
+
+	if dev.Filesystem, err = ReadFilesystem(f); err != nil {
+		dev.Err = fmt.Errorf("%s: %w: %s", dev.Path, ErrUnreadable, err)
+	}
+
+	if dev.IsPartition() {
+		table, ok := tables[dev.Disk]
+		if !ok {
+			table = readPartitionTable(filepath.Join(devDir, dev.Disk))
+			tables[dev.Disk] = table
+		}
+
+		dev.setPartition(table)
+	}
+
+	return dev, nil
+}
+
+func bus(sys string) string {
+	for _, part := range []struct{ name, bus string }{
+		{"/usb", "usb"},
+		{"/mmc_host/", "mmc"},
+		{"/nvme/", "nvme"},
+		{"/ata", "sata"},
+		{"/virtio", "virtio"},
+	} {
+		if strings.Contains(sys, part.name) {
+			return part.bus
+		}
+	}
+
+	return ""
+}
+
+func readSys(dir string, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+func readPartitionTable(path string) *partitionTable {
+	table := &partitionTable{}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return table
+	}
+	defer f.Close()
+
+	if table.gpt, err = gpt.Read(f); err == nil {
+		return table
+	}
+
+	mbr := make([]byte, 512)
+	if _, err := f.ReadAt(mbr, 0); err == nil && mbr[510] == 0x55 && mbr[511] == 0xaa {
+		table.signature = binary.LittleEndian.Uint32(mbr[440:])
+	}
+
+	return table
+}
+
+func (d *Device) setPartition(table *partitionTable) {
+	if table.gpt != nil {
+		if p, ok := table.gpt.Partition(d.Partition); ok {
+			d.PartUUID = p.UUID.String()
+			d.PartLabel = p.Name
+			d.PartType = p.Type
+			d.PartAttributes = p.Attributes
+		}
+
+		return
+	}
+
+	if table.signature != 0 {
+		d.PartUUID = fmt.Sprintf("%08x-%02x", table.signature, d.Partition)
+	}
+}
+
+func Resolve(spec string) (*Device, error) {
+	match, first, err := matcher(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := Devices()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", spec, err)
+	}
+
+	found := []*Device{}
+	unreadable := []string{}
+	for _, dev := range devices {
+		if match(dev) {
+			found = append(found, dev)
+		} else if dev.Err != nil && dev.Size > 0 {
+			unreadable = append(unreadable, dev.Name)
+		}
+	}
+
+	switch {
+	case len(found) == 1 || len(found) > 1 && first:
+		return found[0], found[0].Err
+	case len(found) > 1:
+		names := []string{}
+		for _, dev := range found {
+			names = append(names, dev.Path)
+		}
+
+		return nil, fmt.Errorf("%s: %w: %s", spec, ErrAmbiguous, strings.Join(names, ", "))
+	case len(unreadable) > 0:
+		return nil, fmt.Errorf("%s: %w: %s could not be probed", spec, ErrUnreadable, strings.Join(unreadable, ", "))
+	}
+
+	return nil, fmt.Errorf("%s: %w", spec, ErrNotFound)
+}
+
+func matcher(spec string) (func(*Device) bool, bool, error) {
+	if strings.HasPrefix(spec, "/") {
+		path := spec
+		if resolved, err := filepath.EvalSymlinks(spec); err == nil {
+			path = resolved
+		}
+
+		name := filepath.Base(path)
+		return func(d *Device) bool { return d.Name == name }, false, nil
+	}
+
+	if key, value, ok := strings.Cut(spec, "="); ok {
+		value = strings.Trim(value, "\"")
+		switch strings.ToUpper(key) {
+		case "UUID":
+			return func(d *Device) bool { return d.UUID != "" && strings.EqualFold(d.UUID, value) }, false, nil
+		case "PARTUUID":
+			return func(d *Device) bool { return d.PartUUID != "" && strings.EqualFold(d.PartUUID, value) }, false, nil
+		case "LABEL":
+			return func(d *Device) bool { return d.Label != "" && d.Label == value }, false, nil
+		case "PARTLABEL":
+			return func(d *Device) bool { return d.PartLabel != "" && d.PartLabel == value }, false, nil
+		}
+
+		return nil, false, fmt.Errorf("%s: %w: unknown key %s", spec, ErrInvalid, key)
+	}
+
+	var major, minor int
+	if n, err := fmt.Sscanf(spec, "%d:%d", &major, &minor); err == nil && n == 2 {
+		return func(d *Device) bool { return d.Major == major && d.Minor == minor }, false, nil
+	}
+
+	class, qualifier, _ := strings.Cut(spec, ":")
+	if qualifier != "" && qualifier != "first" {
+		return nil, false, fmt.Errorf("%s: %w: unknown qualifier %s", spec, ErrInvalid, qualifier)
+	}
+
+	var match func(*Device) bool
+	switch class {
+	case "removable":
+		match = func(d *Device) bool { return d.Removable }
+	case "fixed":
+		match = func(d *Device) bool { return !d.Removable }
+	case "usb", "mmc", "nvme", "sata", "virtio":
+		match = func(d *Device) bool { return d.Bus == class }
+	default:
+		return nil, false, fmt.Errorf("%s: %w", spec, ErrInvalid)
+	}
+
+	return func(d *Device) bool { return d.Mountable() && match(d) }, qualifier == "first", nil
+}
@@ -0,0 +1,372 @@
+package probe
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+var testUUID = []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+func testVolume(size int, set func(data []byte)) []byte {
+	data := make([]byte, size)
+	set(data)
+	return data
+}
+
+func testExt(label string, compat, incompat, roCompat uint32) []byte {
+	return testVolume(4096, func(data []byte) {
+		le, sb := binary.LittleEndian, data[1024:]
+		le.PutUint16(sb[56:], 0xef53)
+		le.PutUint32(sb[92:], compat)
+		le.PutUint32(sb[96:], incompat)
+		le.PutUint32(sb[100:], roCompat)
+		copy(sb[104:], testUUID)
+		copy(sb[120:], label)
+	})
+}
+
+func testFAT(fat32 bool, label string) []byte {
+	return testVolume(4096, func(data []byte) {
+		le := binary.LittleEndian
+		data[0], data[510], data[511] = 0xeb, 0x55, 0xaa
+		if fat32 {
+			copy(data[82:], "FAT32   ")
+			le.PutUint32(data[67:], 0x1234abcd)
+			copy(data[71:], label)
+		} else {
+			copy(data[54:], "FAT16   ")
+			le.PutUint32(data[39:], 0x1234abcd)
+			copy(data[43:], label)
+		}
+	})
+}
+
+func TestReadFilesystem(t *testing.T) {
+	le := binary.LittleEndian
+	uuid := "01020304-0506-0708-090a-0b0c0d0e0f10"
+	f2fsLabel := []byte{}
+	for _, c := range utf16.Encode([]rune("data")) {
+		f2fsLabel = le.AppendUint16(f2fsLabel, c)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want Filesystem
+	}{
+		{"ext2", testExt("boot", 0, 0, 0), Filesystem{"ext2", uuid, "boot"}},
+		{"ext3", testExt("boot", 0x4, 0x2, 0x1), Filesystem{"ext3", uuid, "boot"}},
+		{"ext4", testExt("pmOS_boot", 0x4, 0x2|0x40, 0x1), Filesystem{"ext4", uuid, "pmOS_boot"}},
+		{"ext4 ro_compat", testExt("", 0x4, 0x2, 0x400), Filesystem{"ext4", uuid, ""}},
+		{"jbd", testExt("", 0, 0x8, 0), Filesystem{"jbd", uuid, ""}},
+		{"btrfs", testVolume(0x11000, func(data []byte) {
+			copy(data[0x10000+64:], "_BHRfS_M")
+			copy(data[0x10000+32:], testUUID)
+			copy(data[0x10000+299:], "pmOS_root")
+		}), Filesystem{"btrfs", uuid, "pmOS_root"}},
+		{"xfs", testVolume(512, func(data []byte) {
+			copy(data, "XFSB")
+			copy(data[32:], testUUID)
+			copy(data[108:], "home")
+		}), Filesystem{"xfs", uuid, "home"}},
+		{"f2fs", testVolume(4096, func(data []byte) {
+			le.PutUint32(data[1024:], 0xf2f52010)
+			copy(data[1024+108:], testUUID)
+			copy(data[1024+124:], f2fsLabel)
+		}), Filesystem{"f2fs", uuid, "data"}},
+		{"erofs", testVolume(2048, func(data []byte) {
+			le.PutUint32(data[1024:], 0xe0f5e1e2)
+			copy(data[1024+48:], testUUID)
+			copy(data[1024+64:], "system")
+		}), Filesystem{"erofs", uuid, "system"}},
+		{"squashfs", testVolume(4096, func(data []byte) { copy(data, "hsqs") }), Filesystem{Type: "squashfs"}},
+		{"exfat", testVolume(512, func(data []byte) {
+			copy(data[3:], "EXFAT   ")
+			le.PutUint32(data[100:], 0x1234abcd)
+		}), Filesystem{Type: "exfat", UUID: "1234-ABCD"}},
+		{"fat16", testFAT(false, "BOOT       "), Filesystem{"vfat", "1234-ABCD", "BOOT"}},
+		{"fat32", testFAT(true, "NO NAME    "), Filesystem{Type: "vfat", UUID: "1234-ABCD"}},
+		{"iso9660", testVolume(0x8800, func(data []byte) {
+			copy(data[0x8001:], "CD001")
+			copy(data[0x8000+40:], "Alpine 3.20 aarch64             ")
+		}), Filesystem{Type: "iso9660", Label: "Alpine 3.20 aarch64"}},
+		{"swap", testVolume(4096, func(data []byte) {
+			copy(data[4086:], "SWAPSPACE2")
+			copy(data[1036:], testUUID)
+			copy(data[1052:], "swap")
+		}), Filesystem{"swap", uuid, "swap"}},
+		{"unknown", make([]byte, 0x11000), Filesystem{}},
+		{"short", make([]byte, 100), Filesystem{}},
+	}
+
+	for _, test := range tests {
+		dev := filepath.Join(t.TempDir(), test.name)
+		os.WriteFile(dev, test.data, 0o644)
+		f, err := os.Open(dev)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fs, err := ReadFilesystem(f); err != nil || fs != test.want {
+			t.Errorf("%s: got %+v, %v, want %+v", test.name, fs, err, test.want)
+		}
+
+		f.Close()
+	}
+}
+
+type testPartition struct {
+	uuid byte
+	name string
+}
+
+func testGPTDisk(parts ...testPartition) []byte {
+	le := binary.LittleEndian
+	disk := make([]byte, 64*512)
+	disk[510], disk[511] = 0x55, 0xaa
+
+	entries := disk[1024 : 1024+128*128]
+	for i, p := range parts {
+		entry := entries[i*128:]
+		copy(entry, []byte{0xaf, 0x3d, 0xc6, 0x0f, 0x83, 0x84, 0x72, 0x47, 0x8e, 0x79, 0x3d, 0x69, 0xd8, 0x47, 0x7d, 0xe4})
+		for j := range 16 {
+			entry[16+j] = p.uuid
+		}
+
+		le.PutUint64(entry[32:], uint64(34+i))
+		le.PutUint64(entry[40:], uint64(34+i))
+		for j, c := range utf16.Encode([]rune(p.name)) {
+			le.PutUint16(entry[56+j*2:], c)
+		}
+	}
+
+	header := disk[512 : 512+92]
+	copy(header, "EFI PART")
+	le.PutUint32(header[8:], 0x00010000)
+	le.PutUint32(header[12:], 92)
+	le.PutUint64(header[24:], 1)
+	le.PutUint64(header[32:], 63)
+	le.PutUint64(header[40:], 34)
+	le.PutUint64(header[48:], 62)
+	le.PutUint64(header[72:], 2)
+	le.PutUint32(header[80:], 128)
+	le.PutUint32(header[84:], 128)
+	le.PutUint32(header[88:], crc32.ChecksumIEEE(entries))
+	le.PutUint32(header[16:], crc32.ChecksumIEEE(header))
+
+	return disk
+}
+
+func testMBRDisk(signature uint32) []byte {
+	disk := make([]byte, 4096)
+	binary.LittleEndian.PutUint32(disk[440:], signature)
+	disk[510], disk[511] = 0x55, 0xaa
+	return disk
+}
+
+type testSysfs struct {
+	t    *testing.T
+	root string
+}
+
+func newTestSysfs(t *testing.T) *testSysfs {
+	t.Helper()
+
+	root := t.TempDir()
+	sysBlock, devDir = filepath.Join(root, "sys/class/block"), filepath.Join(root, "dev")
+	t.Cleanup(func() { sysBlock, devDir = "/sys/class/block", "/dev" })
+
+	os.MkdirAll(sysBlock, 0o755)
+	os.MkdirAll(devDir, 0o755)
+	return &testSysfs{t: t, root: root}
+}
+
+func (s *testSysfs) add(sys string, dev string, attrs map[string]string, data []byte) {
+	s.t.Helper()
+
+	dir := filepath.Join(s.root, "sys/devices", sys)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		s.t.Fatal(err)
+	}
+
+	attrs["dev"] = dev
+	if _, ok := attrs["size"]; !ok {
+		attrs["size"] = "2048"
+	}
+
+	for name, value := range attrs {
+		os.WriteFile(filepath.Join(dir, name), []byte(value+"\n"), 0o644)
+	}
+
+	name := filepath.Base(sys)
+	os.Symlink(dir, filepath.Join(sysBlock, name))
+	if data != nil {
+		os.WriteFile(filepath.Join(devDir, name), data, 0o644)
+	}
+}
+
+func testDisks(t *testing.T) *testSysfs {
+	s := newTestSysfs(t)
+
+	mmc := "platform/soc@0/7c4000.mmc/mmc_host/mmc0/mmc0:0001/block/mmcblk0"
+	s.add(mmc, "179:0", map[string]string{"removable": "0"}, testGPTDisk(testPartition{0xaa, "boot"}, testPartition{0xbb, "root"}))
+	s.add(mmc+"/mmcblk0p1", "179:1", map[string]string{"partition": "1"}, testExt("pmOS_boot", 0x4, 0x2|0x40, 0x1))
+	s.add(mmc+"/mmcblk0p2", "179:2", map[string]string{"partition": "2"}, testFAT(true, "ROOT       "))
+
+	usb := "platform/soc@0/a600000.usb/usb1/1-1/1-1:1.0/host0/target0:0:0/0:0:0:0/block/"
+	s.add(usb+"sda", "8:0", map[string]string{"removable": "1"}, testMBRDisk(0x1234abcd))
+	s.add(usb+"sda/sda1", "8:1", map[string]string{"partition": "1"}, testFAT(false, "STICK      "))
+	s.add(usb+"sda/sda2", "8:2", map[string]string{"partition": "2"}, testExt("STICK", 0, 0, 0))
+
+	s.add("virtual/block/loop0", "7:0", map[string]string{"size": "0"}, nil)
+	return s
+}
+
+func TestDevices(t *testing.T) {
+	testDisks(t)
+
+	devices, err := Devices()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]*Device{}
+	for _, dev := range devices {
+		found[dev.Name] = dev
+	}
+
+	if len(devices) != 7 {
+		t.Fatalf("got %d devices", len(devices))
+	}
+
+	boot := found["mmcblk0p1"]
+	if boot.Path != filepath.Join(devDir, "mmcblk0p1") || boot.Major != 179 || boot.Minor != 1 || boot.Disk != "mmcblk0" ||
+		boot.Partition != 1 || boot.Size != 2048*512 || boot.Removable || boot.Err != nil {
+		t.Errorf("mmcblk0p1: got %+v", boot)
+	}
+
+	if boot.Type != "ext4" || boot.Label != "pmOS_boot" || boot.PartUUID != "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa" || boot.PartLabel != "boot" {
+		t.Errorf("mmcblk0p1: got %+v", boot)
+	}
+
+	if stick := found["sda1"]; !stick.Removable || stick.Type != "vfat" || stick.PartUUID != "1234abcd-01" || stick.PartLabel != "" {
+		t.Errorf("sda1: got %+v", stick)
+	}
+
+	if disk := found["mmcblk0"]; disk.IsPartition() || disk.Type != "" || disk.PartUUID != "" {
+		t.Errorf("mmcblk0: got %+v", disk)
+	}
+
+	if loop := found["loop0"]; !errors.Is(loop.Err, ErrUnreadable) {
+		t.Errorf("loop0: got %v", loop.Err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	testDisks(t)
+
+	tests := []struct {
+		spec string
+		want string
+		err  error
+	}{
+		{"UUID=01020304-0506-0708-090a-0b0c0d0e0f10", "", ErrAmbiguous},
+		{"UUID=1234-abcd", "", ErrAmbiguous},
+		{"PARTUUID=AAAAAAAA-AAAA-AAAA-AAAA-AAAAAAAAAAAA", "mmcblk0p1", nil},
+		{"PARTUUID=1234abcd-02", "sda2", nil},
+		{"LABEL=pmOS_boot", "mmcblk0p1", nil},
+		{`LABEL="ROOT"`, "mmcblk0p2", nil},
+		{"LABEL=STICK", "", ErrAmbiguous},
+		{"PARTLABEL=root", "mmcblk0p2", nil},
+		{"partlabel=boot", "mmcblk0p1", nil},
+		{"8:1", "sda1", nil},
+		{"179:0", "mmcblk0", nil},
+		{"LABEL=missing", "", ErrNotFound},
+		{"PARTLABEL=", "", ErrNotFound},
+		{"1:1", "", ErrNotFound},
+		{"SERIAL=1234", "", ErrInvalid},
+		{"sdcard", "", ErrInvalid},
+	}
+
+	for _, test := range tests {
+		dev, err := Resolve(test.spec)
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("%s: got %v, want %v", test.spec, err, test.err)
+			}
+
+			continue
+		}
+
+		if err != nil || dev.Name != test.want {
+			t.Errorf("%s: got %v, %v, want %s", test.spec, dev, err, test.want)
+		}
+	}
+
+	if dev, err := Resolve(filepath.Join(devDir, "sda2")); err != nil || dev.Name != "sda2" {
+		t.Errorf("path: got %v, %v", dev, err)
+	}
+
+	os.Remove(filepath.Join(devDir, "sda2"))
+	if _, err := Resolve("LABEL=missing"); !errors.Is(err, ErrUnreadable) {
+		t.Errorf("unreadable device: got %v", err)
+	}
+}
+
+func TestResolveClass(t *testing.T) {
+	testDisks(t)
+
+	tests := []struct {
+		spec string
+		want string
+		err  error
+	}{
+		{"usb", "", ErrAmbiguous},
+		{"usb:first", "sda1", nil},
+		{"mmc:first", "mmcblk0p1", nil},
+		{"removable:first", "sda1", nil},
+		{"fixed:first", "mmcblk0p1", nil},
+		{"nvme", "", ErrNotFound},
+		{"usb:last", "", ErrInvalid},
+	}
+
+	for _, test := range tests {
+		dev, err := Resolve(test.spec)
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("%s: got %v, want %v", test.spec, err, test.err)
+			}
+
+			continue
+		}
+
+		if err != nil || dev.Name != test.want {
+			t.Errorf("%s: got %v, %v, want %s", test.spec, dev, err, test.want)
+		}
+	}
+
+	devices, err := Devices()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dev := range devices {
+		want := ""
+		switch {
+		case strings.HasPrefix(dev.Name, "mmcblk"):
+			want = "mmc"
+		case strings.HasPrefix(dev.Name, "sd"):
+			want = "usb"
+		}
+
+		if dev.Bus != want {
+			t.Errorf("%s: bus %q, want %q", dev.Name, dev.Bus, want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package sysinit
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+type firmwareDir struct {
+	path string
+	flat bool
+}
+
+var (
+	firmwareLock    sync.Mutex
+	firmwareDirs    = []firmwareDir{{path: "/lib/firmware"}}
+	firmwarePending = map[string]string{}
+	firmwareReady   = false
+	firmwareSys     = "/sys"
+)
+
+func AddFirmwareDir(dir string, flat bool) {
+	firmwareLock.Lock()
+	defer firmwareLock.Unlock()
+
+	firmwareDirs = append(firmwareDirs, firmwareDir{path: dir, flat: flat})
+	for sys, name := range firmwarePending {
+		if serveFirmware(sys, name) {
+			delete(firmwarePending, sys)
+		}
+	}
+}
+
+func RemoveFirmwareDir(dir string) {
+	firmwareLock.Lock()
+	defer firmwareLock.Unlock()
+
+	for i, d := range firmwareDirs {
+		if d.path == dir {
+			firmwareDirs = append(firmwareDirs[:i], firmwareDirs[i+1:]...)
+			return
+		}
+	}
+}
+
+func FirmwareReady() {
+	firmwareLock.Lock()
+	defer firmwareLock.Unlock()
+
+	firmwareReady = true
+	for sys, name := range firmwarePending {
+		log.Printf("firmware: %s not found", name)
+		cancelFirmware(sys)
+		delete(firmwarePending, sys)
+	}
+}
+
+func ServeFirmware() {
+	if err := os.WriteFile("/proc/sys/kernel/firmware_config/force_sysfs_fallback", []byte("1"), 0o644); err != nil {
+		log.Print("firmware: ", err)
+	}
+
+	events, _ := SubscribeUevents()
+	go func() {
+		for event := range events {
+			if event.Subsystem != "firmware" || event.Env["FIRMWARE"] == "" {
+				continue
+			}
+
+			handleFirmware(event)
+		}
+	}()
+}
+
+func handleFirmware(event Uevent) {
+	firmwareLock.Lock()
+	defer firmwareLock.Unlock()
+
+	sys := filepath.Join(firmwareSys, event.DevPath)
+	name := event.Env["FIRMWARE"]
+
+	switch event.Action {
+	case "add":
+		if serveFirmware(sys, name) {
+			return
+		}
+
+		if firmwareReady {
+			log.Printf("firmware: %s not found", name)
+			cancelFirmware(sys)
+			return
+		}
+
+		firmwarePending[sys] = name
+	case "remove":
+		delete(firmwarePending, sys)
+	}
+}
+
+func findFirmware(name string) (string, bool) {
+	for _, dir := range firmwareDirs {
+		file := filepath.Join(dir.path, name)
+		if dir.flat {
+			file = filepath.Join(dir.path, filepath.Base(name))
+		}
+
+		if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+			return file, true
+		}
+	}
+
+	return "", false
+}
+
+func serveFirmware(sys string, name string) bool {
+	file, ok := findFirmware(name)
+	if !ok {
+		return false
+	}
+
+	if err := loadFirmware(sys, file); err != nil {
+		log.Printf("firmware: %s: %s", name, err)
+		cancelFirmware(sys)
+		return true
+	}
+
+	log.Printf("firmware: loaded %s from %s", name, file)
+	return true
+}
+
+func loadFirmware(sys string, file string) error {
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.WriteFile(filepath.Join(sys, "loading"), []byte("1"), 0o644); err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(filepath.Join(sys, "data"), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("data: %w", err)
+	}
+
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("data: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(sys, "loading"), []byte("0"), 0o644)
+}
+
+func cancelFirmware(sys string) {
+	os.WriteFile(filepath.Join(sys, "loading"), []byte("-1"), 0o644)
+}
@@ -0,0 +1,120 @@
+package sysinit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testFirmwareRequest(t *testing.T, name string) (Uevent, string) {
+	t.Helper()
+
+	devpath := "/devices/platform/soc/firmware/" + strings.ReplaceAll(name, "/", "!")
+	sys := filepath.Join(firmwareSys, devpath)
+	if err := os.MkdirAll(sys, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(filepath.Join(sys, "loading"), nil, 0o644)
+	os.WriteFile(filepath.Join(sys, "data"), nil, 0o644)
+
+	return Uevent{Action: "add", DevPath: devpath, Subsystem: "firmware", Env: map[string]string{"FIRMWARE": name}}, sys
+}
+
+func firmwareState(t *testing.T, sys string) (string, string) {
+	t.Helper()
+
+	loading, _ := os.ReadFile(filepath.Join(sys, "loading"))
+	data, _ := os.ReadFile(filepath.Join(sys, "data"))
+	return string(loading), string(data)
+}
+
+func resetFirmware(t *testing.T, dirs ...firmwareDir) {
+	t.Helper()
+
+	saved := firmwareDirs
+	t.Cleanup(func() {
+		firmwareDirs, firmwarePending, firmwareReady, firmwareSys = saved, map[string]string{}, false, "/sys"
+	})
+
+	firmwareDirs, firmwarePending, firmwareReady, firmwareSys = dirs, map[string]string{}, false, t.TempDir()
+}
+
+func TestHandleFirmware(t *testing.T) {
+	dir, flat := t.TempDir(), t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "qcom/sc7180"), 0o755)
+	os.WriteFile(filepath.Join(dir, "qcom/sc7180/a630_zap.mbn"), []byte("zap"), 0o644)
+	os.WriteFile(filepath.Join(flat, "modem.mdt"), []byte("modem"), 0o644)
+	os.Mkdir(filepath.Join(dir, "directory.bin"), 0o755)
+	resetFirmware(t, firmwareDir{path: dir}, firmwareDir{path: flat, flat: true})
+
+	tests := []struct {
+		name    string
+		loading string
+		data    string
+	}{
+		{"qcom/sc7180/a630_zap.mbn", "0", "zap"},
+		{"qcom/sc7180/modem.mdt", "0", "modem"},
+		{"directory.bin", "", ""},
+		{"missing.bin", "", ""},
+	}
+
+	for _, test := range tests {
+		event, sys := testFirmwareRequest(t, test.name)
+		handleFirmware(event)
+		if loading, data := firmwareState(t, sys); loading != test.loading || data != test.data {
+			t.Errorf("%s: loading = %q, data = %q", test.name, loading, data)
+		}
+	}
+
+	if len(firmwarePending) != 2 {
+		t.Errorf("pending = %v", firmwarePending)
+	}
+}
+
+func TestPendingFirmware(t *testing.T) {
+	resetFirmware(t)
+
+	late, lateSys := testFirmwareRequest(t, "ath10k/WCN3990/hw1.0/board-2.bin")
+	missing, missingSys := testFirmwareRequest(t, "missing.bin")
+	removed, removedSys := testFirmwareRequest(t, "removed.bin")
+	for _, event := range []Uevent{late, missing, removed} {
+		handleFirmware(event)
+	}
+
+	removed.Action = "remove"
+	handleFirmware(removed)
+	if len(firmwarePending) != 2 {
+		t.Fatalf("pending = %v", firmwarePending)
+	}
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "ath10k/WCN3990/hw1.0"), 0o755)
+	os.WriteFile(filepath.Join(dir, "ath10k/WCN3990/hw1.0/board-2.bin"), []byte("board"), 0o644)
+	AddFirmwareDir(dir, false)
+
+	if loading, data := firmwareState(t, lateSys); loading != "0" || data != "board" {
+		t.Errorf("late firmware: loading = %q, data = %q", loading, data)
+	}
+
+	FirmwareReady()
+	if loading, _ := firmwareState(t, missingSys); loading != "-1" {
+		t.Errorf("missing firmware: loading = %q, want it cancelled", loading)
+	}
+
+	if loading, _ := firmwareState(t, removedSys); loading != "" {
+		t.Errorf("removed request: loading = %q", loading)
+	}
+
+	again, againSys := testFirmwareRequest(t, "missing.bin")
+	handleFirmware(again)
+	if loading, _ := firmwareState(t, againSys); loading != "-1" || len(firmwarePending) != 0 {
+		t.Errorf("after FirmwareReady: loading = %q, pending = %v", loading, firmwarePending)
+	}
+
+	RemoveFirmwareDir(dir)
+	if len(firmwareDirs) != 0 {
+		t.Errorf("dirs = %v", firmwareDirs)
+	}
+}
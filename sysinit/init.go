@@ -59,6 +59,13 @@ func Init() {
 	SetLog()
 	InstallBusybox()
 	MakeDevs()
+
+	if err := StartUevents(); err != nil {
+		log.Print("uevent: ", err)
+	}
+
+	ServeFirmware()
+	LoadModules()
 }
 
 func MakeDevs() {
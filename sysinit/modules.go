@@ -0,0 +1,264 @@
+package sysinit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+type Modules struct {
+	Dir       string
+	Allow     map[string]bool
+	Block     map[string]bool
+	aliases   []moduleAlias
+	deps      map[string][]string
+	files     map[string]string
+	loadLock  sync.Mutex
+	attempted map[string]bool
+}
+
+type moduleAlias struct {
+	pattern string
+	module  string
+}
+
+func ModuleName(file string) string {
+	name := filepath.Base(file)
+	if i := strings.Index(name, ".ko"); i >= 0 {
+		name = name[:i]
+	}
+
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+func moduleList(value string) map[string]bool {
+	list := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			list[ModuleName(name)] = true
+		}
+	}
+
+	return list
+}
+
+func OpenModules() (*Modules, error) {
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err != nil {
+		return nil, err
+	}
+
+	release := unix.ByteSliceToString(uname.Release[:])
+	m := &Modules{
+		Dir:       filepath.Join("/lib/modules", release),
+		Allow:     moduleList(Args["sideboot.modules"]),
+		Block:     moduleList(Args["sideboot.blocklist"]),
+		deps:      map[string][]string{},
+		files:     map[string]string{},
+		attempted: map[string]bool{},
+	}
+
+	if err := m.readDeps(); err != nil {
+		return nil, err
+	}
+
+	if err := m.readAliases(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *Modules) readDeps() error {
+	f, err := os.Open(filepath.Join(m.Dir, "modules.dep"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		file, deps, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+
+		name := ModuleName(file)
+		m.files[name] = file
+		for _, dep := range strings.Fields(deps) {
+			m.deps[name] = append(m.deps[name], ModuleName(dep))
+			m.files[ModuleName(dep)] = dep
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (m *Modules) readAliases() error {
+	f, err := os.Open(filepath.Join(m.Dir, "modules.alias"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || fields[0] != "alias" {
+			continue
+		}
+
+		m.aliases = append(m.aliases, moduleAlias{pattern: fields[1], module: ModuleName(fields[2])})
+	}
+
+	return scanner.Err()
+}
+
+func (m *Modules) Resolve(modalias string) []string {
+	modules := []string{}
+	for _, alias := range m.aliases {
+		if ok, _ := path.Match(alias.pattern, modalias); ok {
+			modules = append(modules, alias.module)
+		}
+	}
+
+	return modules
+}
+
+func (m *Modules) LoadAlias(modalias string) {
+	for _, name := range m.Resolve(modalias) {
+		if len(m.Allow) > 0 && !m.Allow[name] || m.Block[name] {
+			continue
+		}
+
+		if err := m.Load(name); err != nil {
+			log.Printf("modules: %s: %s", modalias, err)
+		}
+	}
+}
+
+func (m *Modules) Load(name string) error {
+	m.loadLock.Lock()
+	defer m.loadLock.Unlock()
+
+	return m.load(ModuleName(name))
+}
+
+func (m *Modules) load(name string) error {
+	if m.Block[name] {
+		return fmt.Errorf("%s is blocklisted", name)
+	}
+
+	if m.attempted[name] || FileExist(filepath.Join("/sys/module", name)) {
+		return nil
+	}
+
+	m.attempted[name] = true
+
+	file, ok := m.files[name]
+	if !ok {
+		return fmt.Errorf("%s is not in modules.dep", name)
+	}
+
+	deps := m.deps[name]
+	for i := len(deps) - 1; i >= 0; i-- {
+		if err := m.load(deps[i]); err != nil {
+			return fmt.Errorf("%s: dependency %w", name, err)
+		}
+	}
+
+	return insertModule(filepath.Join(m.Dir, file))
+}
+
+func insertModule(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	flags := 0
+	if ext := filepath.Ext(file); ext != ".ko" {
+		flags |= unix.MODULE_INIT_COMPRESSED_FILE
+	}
+
+	err = unix.FinitModule(int(f.Fd()), "", flags)
+	if errors.Is(err, unix.EEXIST) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", ModuleName(file), err)
+	}
+
+	log.Printf("modules: loaded %s", ModuleName(file))
+	return nil
+}
+
+func (m *Modules) Coldplug() {
+	seen := map[string]bool{}
+	filepath.WalkDir("/sys/devices", func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.Name() != "modalias" || d.IsDir() {
+			return nil
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil
+		}
+
+		if alias := strings.TrimSpace(string(data)); alias != "" && !seen[alias] {
+			seen[alias] = true
+			m.LoadAlias(alias)
+		}
+
+		return nil
+	})
+}
+
+func (m *Modules) Hotplug(events <-chan Uevent) {
+	for event := range events {
+		if alias := event.Env["MODALIAS"]; alias != "" && event.Action == "add" {
+			m.LoadAlias(alias)
+		}
+	}
+}
+
+var modules *Modules
+
+func loadFilesystemModules(types []string) bool {
+	if modules == nil {
+		return false
+	}
+
+	for _, fstype := range types {
+		modules.LoadAlias("fs-" + fstype)
+	}
+
+	return true
+}
+
+func LoadModules() {
+	m, err := OpenModules()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Print("modules: ", err)
+		}
+
+		return
+	}
+
+	modules = m
+	events, _ := SubscribeUevents()
+	go m.Hotplug(events)
+	go m.Coldplug()
+}
@@ -0,0 +1,124 @@
+package sysinit
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testModules(t *testing.T) *Modules {
+	t.Helper()
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "modules.dep"), []byte(strings.Join([]string{
+		"kernel/drivers/mmc/host/sdhci-msm.ko.zst: kernel/drivers/mmc/host/sdhci-pltfm.ko.zst kernel/drivers/mmc/host/sdhci.ko.zst",
+		"kernel/drivers/mmc/host/sdhci-pltfm.ko.zst: kernel/drivers/mmc/host/sdhci.ko.zst",
+		"kernel/drivers/mmc/host/sdhci.ko.zst:",
+		"kernel/drivers/usb/storage/usb-storage.ko:",
+		"kernel/drivers/net/test-blocked.ko: kernel/drivers/net/test-dep.ko",
+		"garbage",
+	}, "\n")), 0o644)
+
+	os.WriteFile(filepath.Join(dir, "modules.alias"), []byte(strings.Join([]string{
+		"# Aliases extracted from modules themselves.",
+		"alias of:N*T*Cqcom,sdhci-msm-v5C* sdhci_msm",
+		"alias of:N*T*Cqcom,sdhci-msm-v5 sdhci_msm",
+		"alias usb:v*p*d*dc*dsc*dp*ic08isc06ip50in* usb_storage",
+		"alias usb:v*p*d*dc*dsc*dp*ic08isc06ip50in* uas",
+		"alias pci:v0000BEEFd* test-blocked",
+		"softdep sdhci_msm pre: crypto",
+	}, "\n")), 0o644)
+
+	m := &Modules{
+		Dir:       dir,
+		Block:     moduleList("uas, test_dep"),
+		deps:      map[string][]string{},
+		files:     map[string]string{},
+		attempted: map[string]bool{},
+	}
+
+	if err := m.readDeps(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.readAliases(); err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func TestModuleName(t *testing.T) {
+	for file, want := range map[string]string{
+		"kernel/drivers/mmc/host/sdhci-msm.ko.zst": "sdhci_msm",
+		"usb-storage.ko": "usb_storage",
+		"sdhci_msm":      "sdhci_msm",
+		"btqca.ko.xz":    "btqca",
+	} {
+		if got := ModuleName(file); got != want {
+			t.Errorf("%s: got %s, want %s", file, got, want)
+		}
+	}
+
+	if got := moduleList(" usb-storage,,uas.ko ,"); !reflect.DeepEqual(got, map[string]bool{"usb_storage": true, "uas": true}) {
+		t.Errorf("moduleList = %v", got)
+	}
+}
+
+func TestReadModuleIndex(t *testing.T) {
+	m := testModules(t)
+
+	if got := m.files["sdhci_pltfm"]; got != "kernel/drivers/mmc/host/sdhci-pltfm.ko.zst" {
+		t.Errorf("file = %q", got)
+	}
+
+	if got := m.deps["sdhci_msm"]; !reflect.DeepEqual(got, []string{"sdhci_pltfm", "sdhci"}) {
+		t.Errorf("deps = %q", got)
+	}
+
+	if got := m.deps["sdhci"]; got != nil {
+		t.Errorf("sdhci deps = %q", got)
+	}
+
+	if len(m.aliases) != 5 {
+		t.Errorf("%d aliases, want 5", len(m.aliases))
+	}
+}
+
+func TestResolve(t *testing.T) {
+	m := testModules(t)
+	tests := []struct {
+		modalias string
+		want     []string
+	}{
+		{"of:NmmcT(null)Cqcom,sdhci-msm-v5", []string{"sdhci_msm"}},
+		{"of:NmmcT(null)Cqcom,sdhci-msm-v5Cqcom,sdhci", []string{"sdhci_msm"}},
+		{"of:NmmcT(null)Cqcom,sc7180-sdhciCqcom,sdhci-msm-v5", []string{"sdhci_msm"}},
+		{"usb:v0781p5581d0100dc00dsc00dp00ic08isc06ip50in00", []string{"usb_storage", "uas"}},
+		{"of:NmmcT(null)Cqcom,sdhci-msm-v4", []string{}},
+	}
+
+	for _, test := range tests {
+		if got := m.Resolve(test.modalias); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.modalias, got, test.want)
+		}
+	}
+}
+
+func TestLoadBlocked(t *testing.T) {
+	m := testModules(t)
+
+	if err := m.Load("uas"); err == nil || !strings.Contains(err.Error(), "blocklisted") {
+		t.Errorf("blocklisted module: got %v", err)
+	}
+
+	if err := m.Load("test-blocked"); err == nil || !strings.Contains(err.Error(), "dependency test_dep is blocklisted") {
+		t.Errorf("blocklisted dependency: got %v", err)
+	}
+
+	if err := m.Load("test_missing"); err == nil || !strings.Contains(err.Error(), "not in modules.dep") {
+		t.Errorf("unknown module: got %v", err)
+	}
+}
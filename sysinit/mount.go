@@ -0,0 +1,83 @@
+package sysinit
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+var readOnlyOptions = map[string]string{
+	"ext3":  "noload",
+	"ext4":  "noload",
+	"xfs":   "norecovery",
+	"btrfs": "norecovery",
+	"f2fs":  "norecovery",
+	"vfat":  "shortname=mixed",
+}
+
+var fsDrivers = map[string][]string{
+	"ext2": {"ext2", "ext4"},
+	"ext3": {"ext3", "ext4"},
+	"vfat": {"vfat", "msdos"},
+}
+
+var filesystemsPath = "/proc/filesystems"
+
+func Filesystems() []string {
+	types := []string{}
+	for _, line := range strings.Split(ReadFile(filesystemsPath), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 {
+			types = append(types, fields[len(fields)-1])
+		}
+	}
+
+	return types
+}
+
+func MountReadOnly(source string, target string, fstype string) error {
+	if fstype == "" {
+		return fmt.Errorf("%s: no known filesystem", source)
+	}
+
+	drivers := mountDrivers(fstype)
+	if len(drivers) == 0 {
+		return fmt.Errorf("%s: kernel has no driver for %s filesystem", source, fstype)
+	}
+
+	var err error
+	for _, driver := range drivers {
+		mnt := Mount{Source: source, Target: target, Type: driver, Flags: unix.MS_RDONLY, Opts: readOnlyOptions[driver]}
+		if err = mnt.Run(); err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s: mount %s read-only: %w", source, fstype, err)
+}
+
+func mountDrivers(fstype string) []string {
+	drivers := fsDrivers[fstype]
+	if drivers == nil {
+		drivers = []string{fstype}
+	}
+
+	available := Filesystems()
+	if len(available) == 0 {
+		return drivers
+	}
+
+	missing := slices.DeleteFunc(slices.Clone(drivers), func(driver string) bool {
+		return slices.Contains(available, driver)
+	})
+
+	if len(missing) > 0 && loadFilesystemModules(missing) {
+		available = Filesystems()
+	}
+
+	return slices.DeleteFunc(slices.Clone(drivers), func(driver string) bool {
+		return !slices.Contains(available, driver)
+	})
+}
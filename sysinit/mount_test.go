@@ -0,0 +1,37 @@
+package sysinit
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMountDrivers(t *testing.T) {
+	filesystemsPath = filepath.Join(t.TempDir(), "filesystems")
+	t.Cleanup(func() { filesystemsPath, modules = "/proc/filesystems", nil })
+	os.WriteFile(filesystemsPath, []byte("nodev\tsysfs\nnodev\tproc\n\text4\n\tvfat\n"), 0o644)
+
+	tests := []struct {
+		fstype string
+		want   []string
+	}{
+		{"ext2", []string{"ext4"}},
+		{"ext4", []string{"ext4"}},
+		{"vfat", []string{"vfat"}},
+		{"sideboot_testfs", []string{}},
+	}
+
+	for _, test := range tests {
+		if got := mountDrivers(test.fstype); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.fstype, got, test.want)
+		}
+	}
+
+	modules = testModules(t)
+	modules.aliases = append(modules.aliases, moduleAlias{pattern: "fs-sideboot_testfs", module: "sideboot_testfs"})
+	modules.files["sideboot_testfs"] = "kernel/fs/sideboot_testfs.ko"
+	if got := mountDrivers("sideboot_testfs"); len(got) != 0 || !modules.attempted["sideboot_testfs"] {
+		t.Errorf("missing filesystem: got %q, module attempted = %v", got, modules.attempted["sideboot_testfs"])
+	}
+}
@@ -0,0 +1,119 @@
+package sysinit
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+type Uevent struct {
+	Action    string
+	DevPath   string
+	Subsystem string
+	Env       map[string]string
+}
+
+var (
+	ueventLock        sync.Mutex
+	ueventSubscribers = map[chan Uevent]struct{}{}
+	ueventStarted     = false
+)
+
+func StartUevents() error {
+	ueventLock.Lock()
+	defer ueventLock.Unlock()
+
+	if ueventStarted {
+		return nil
+	}
+
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return err
+	}
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: 1}); err != nil {
+		unix.Close(fd)
+		return err
+	}
+
+	unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUFFORCE, 1<<20)
+
+	ueventStarted = true
+	go readUevents(fd)
+	return nil
+}
+
+func UeventsStarted() bool {
+	ueventLock.Lock()
+	defer ueventLock.Unlock()
+
+	return ueventStarted
+}
+
+func SubscribeUevents() (<-chan Uevent, func()) {
+	ch := make(chan Uevent, 64)
+
+	ueventLock.Lock()
+	ueventSubscribers[ch] = struct{}{}
+	ueventLock.Unlock()
+
+	return ch, func() {
+		ueventLock.Lock()
+		delete(ueventSubscribers, ch)
+		ueventLock.Unlock()
+	}
+}
+
+func readUevents(fd int) {
+	buf := make([]byte, 16384)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err == unix.EINTR || err == unix.ENOBUFS {
+			continue
+		}
+
+		if err != nil {
+			log.Print("uevent: ", err)
+			return
+		}
+
+		event, ok := ParseUevent(buf[:n])
+		if !ok {
+			continue
+		}
+
+		ueventLock.Lock()
+		for ch := range ueventSubscribers {
+			select {
+			case ch <- event:
+			default:
+				log.Printf("uevent: subscriber is full, dropping %s %s", event.Action, event.DevPath)
+			}
+		}
+		ueventLock.Unlock()
+	}
+}
+
+func ParseUevent(msg []byte) (Uevent, bool) {
+	fields := bytes.Split(msg, []byte{0})
+	if len(fields) < 2 || !bytes.Contains(fields[0], []byte("@")) {
+		return Uevent{}, false
+	}
+
+	event := Uevent{Env: map[string]string{}}
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(string(field), "=")
+		if ok {
+			event.Env[key] = value
+		}
+	}
+
+	event.Action = event.Env["ACTION"]
+	event.DevPath = event.Env["DEVPATH"]
+	event.Subsystem = event.Env["SUBSYSTEM"]
+	return event, event.Action != ""
+}
@@ -0,0 +1,79 @@
+package sysinit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseUevent(t *testing.T) {
+	msg := strings.Join([]string{
+		"add@/devices/platform/soc/7c4000.mmc/mmc_host/mmc1/mmc1:0001/block/mmcblk1/mmcblk1p1",
+		"ACTION=add",
+		"DEVPATH=/devices/platform/soc/7c4000.mmc/mmc_host/mmc1/mmc1:0001/block/mmcblk1/mmcblk1p1",
+		"SUBSYSTEM=block",
+		"MAJOR=179",
+		"MINOR=1",
+		"DEVNAME=mmcblk1p1",
+		"DEVTYPE=partition",
+		"PARTN=1",
+		"SEQNUM=1523",
+		"",
+	}, "\x00")
+
+	event, ok := ParseUevent([]byte(msg))
+	if !ok {
+		t.Fatal("not parsed")
+	}
+
+	if event.Action != "add" || event.Subsystem != "block" || !strings.HasSuffix(event.DevPath, "/mmcblk1p1") {
+		t.Errorf("got %+v", event)
+	}
+
+	want := map[string]string{"DEVNAME": "mmcblk1p1", "DEVTYPE": "partition", "PARTN": "1"}
+	for key, value := range want {
+		if event.Env[key] != value {
+			t.Errorf("%s: got %q, want %q", key, event.Env[key], value)
+		}
+	}
+
+	for _, msg := range []string{
+		"",
+		"add@/devices/virtual/block/loop0",
+		"libudev\x00\xfe\xed\xca\xfe",
+		"ACTION=add\x00DEVPATH=/devices/virtual/block/loop0\x00",
+		"change@/devices/virtual/block/loop0\x00DEVPATH=/devices/virtual/block/loop0\x00",
+	} {
+		if event, ok := ParseUevent([]byte(msg)); ok {
+			t.Errorf("%q: got %+v", msg, event)
+		}
+	}
+}
+
+func TestSubscribeUevents(t *testing.T) {
+	events, unsubscribe := SubscribeUevents()
+	other, unsubscribeOther := SubscribeUevents()
+	defer unsubscribeOther()
+
+	event := Uevent{Action: "add", DevPath: "/devices/virtual/block/loop0", Subsystem: "block"}
+	ueventLock.Lock()
+	for ch := range ueventSubscribers {
+		ch <- event
+	}
+	ueventLock.Unlock()
+
+	for _, ch := range []<-chan Uevent{events, other} {
+		if got := <-ch; !reflect.DeepEqual(got, event) {
+			t.Errorf("got %+v", got)
+		}
+	}
+
+	unsubscribe()
+	ueventLock.Lock()
+	n := len(ueventSubscribers)
+	ueventLock.Unlock()
+
+	if n != 1 {
+		t.Errorf("%d subscribers left after unsubscribe", n)
+	}
+}